@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/curusarn/resh/pkg/msg"
+	"github.com/curusarn/resh/pkg/queryhist"
+	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/tags"
+)
+
+// modal views - only one of them can be shown at a time
+const (
+	modalNone    = ""
+	modalConfirm = "confirm"
+	modalTag     = "tag"
+	modalEdit    = "edit"
+	modalQueries = "queries"
+)
+
+// targetItems returns marked items or the highlighted item if nothing is marked
+//		expects the state to be locked
+func (m manager) targetItems() []item {
+	if len(m.s.marked) > 0 {
+		var items []item
+		for _, itm := range m.s.marked {
+			items = append(items, itm)
+		}
+		return items
+	}
+	if m.s.highlightedItem < len(m.s.data) {
+		return []item{m.s.data[m.s.highlightedItem]}
+	}
+	return nil
+}
+
+func itemCmdLines(items []item) []string {
+	var cmdLines []string
+	seen := map[string]bool{}
+	for _, itm := range items {
+		if seen[itm.cmdLine] {
+			continue
+		}
+		seen[itm.cmdLine] = true
+		cmdLines = append(cmdLines, itm.cmdLine)
+	}
+	return cmdLines
+}
+
+func inputBuffer(g *gocui.Gui) string {
+	v, err := g.View("input")
+	if err != nil {
+		return ""
+	}
+	return v.Buffer()
+}
+
+// ToggleMark marks/unmarks highlighted item and moves to the next one
+func (m manager) ToggleMark(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	if m.s.highlightedItem < len(m.s.data) {
+		itm := m.s.data[m.s.highlightedItem]
+		if _, found := m.s.marked[itm.key()]; found {
+			delete(m.s.marked, itm.key())
+		} else {
+			m.s.marked[itm.key()] = itm
+		}
+	}
+	m.s.lock.Unlock()
+	m.moveHighlight(1)
+	return nil
+}
+
+// PrintMarked prints command lines of marked items to stdout (one per line)
+func (m manager) PrintMarked(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	items := m.targetItems()
+	if len(items) == 0 {
+		return nil
+	}
+	// keep the order in which the items are shown
+	var cmdLines []string
+	printed := map[string]bool{}
+	for _, itm := range m.s.data {
+		if _, found := m.s.marked[itm.key()]; found {
+			cmdLines = append(cmdLines, itm.cmdLine)
+			printed[itm.key()] = true
+		}
+	}
+	for _, itm := range items {
+		if printed[itm.key()] == false {
+			cmdLines = append(cmdLines, itm.cmdLine)
+		}
+	}
+	m.pick(queryhist.ActionPrint)
+	m.s.output = strings.Join(cmdLines, "\n")
+	m.s.exitCode = exitCodePrint
+	return gocui.ErrQuit
+}
+
+// Delete asks for confirmation and deletes marked items from history
+func (m manager) Delete(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	items := m.targetItems()
+	if len(items) == 0 {
+		return nil
+	}
+	question := "Delete " + strconv.Itoa(len(items)) + " command(s) from history? [y/N]"
+	if len(items) == 1 {
+		question = "Delete '" + items[0].cmdLine + "' from history? [y/N]"
+	}
+	m.s.modal = modalConfirm
+	m.s.confirmQuestion = question
+	m.s.confirmAction = func() error {
+		return m.deleteItems(g, items)
+	}
+	return nil
+}
+
+func (m manager) deleteItems(g *gocui.Gui, items []item) error {
+	var refs []msg.ItemRef
+	toDelete := map[msg.ItemRef]bool{}
+	for _, itm := range items {
+		ref := msg.ItemRef{CmdLine: itm.cmdLine, Pwd: itm.pwd}
+		refs = append(refs, ref)
+		toDelete[ref] = true
+	}
+	resp, err := sendDeleteMsg(msg.DeleteMsg{Items: refs}, strconv.Itoa(m.config.Port))
+	if err != nil {
+		return err
+	}
+	m.s.lock.Lock()
+	// records are not modified in place because they might be used by a running search
+	var fullRecords []records.EnrichedRecord
+	for _, rec := range m.s.fullRecords {
+		if toDelete[msg.ItemRef{CmdLine: rec.CmdLine, Pwd: rec.Pwd}] == false {
+			fullRecords = append(fullRecords, rec)
+		}
+	}
+	m.s.fullRecords = fullRecords
+	m.s.cmdStats = computeCmdStats(fullRecords)
+	m.s.index = newSearchIndex(fullRecords)
+	m.s.marked = map[string]item{}
+	m.s.statusMsg = "deleted " + strconv.Itoa(resp.Deleted) + " record(s)"
+	m.s.lock.Unlock()
+	m.UpdateData(inputBuffer(g))
+	return nil
+}
+
+// ToggleFavourite adds/removes marked items to/from favourites
+func (m manager) ToggleFavourite(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	items := m.targetItems()
+	allFavourite := true
+	for _, itm := range items {
+		if hasTag(itm.record.Tags, tags.Favourite) == false {
+			allFavourite = false
+		}
+	}
+	m.s.lock.Unlock()
+	if len(items) == 0 {
+		return nil
+	}
+	m.tagItems(g, items, tags.Favourite, allFavourite)
+	return nil
+}
+
+// Tag opens a prompt to tag marked items
+func (m manager) Tag(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if len(m.targetItems()) == 0 {
+		return nil
+	}
+	m.s.modal = modalTag
+	return nil
+}
+
+// TagConfirm tags marked items with the tag from the prompt
+//		tag prefixed with '-' is removed instead
+func (m manager) TagConfirm(g *gocui.Gui, v *gocui.View) error {
+	tag := strings.TrimSpace(v.Buffer())
+	m.s.lock.Lock()
+	items := m.targetItems()
+	m.s.modal = modalNone
+	m.s.lock.Unlock()
+	remove := false
+	if strings.HasPrefix(tag, "-") {
+		remove = true
+		tag = tag[1:]
+	}
+	if tag == "" || strings.ContainsAny(tag, " \t") {
+		return nil
+	}
+	m.tagItems(g, items, tag, remove)
+	return nil
+}
+
+func (m manager) tagItems(g *gocui.Gui, items []item, tag string, remove bool) {
+	cmdLines := itemCmdLines(items)
+	err := sendTagMsg(msg.TagMsg{CmdLines: cmdLines, Tag: tag, Remove: remove}, strconv.Itoa(m.config.Port))
+	m.s.lock.Lock()
+	if err != nil {
+		m.s.statusMsg = "tagging failed: " + err.Error()
+		m.s.lock.Unlock()
+		return
+	}
+	tagged := map[string]bool{}
+	for _, cmdLine := range cmdLines {
+		tagged[cmdLine] = true
+	}
+	// records are not modified in place because they might be used by a running search
+	fullRecords := make([]records.EnrichedRecord, len(m.s.fullRecords))
+	for i, rec := range m.s.fullRecords {
+		if tagged[rec.CmdLine] {
+			rec.Tags = updateTags(rec.Tags, tag, remove)
+		}
+		fullRecords[i] = rec
+	}
+	m.s.fullRecords = fullRecords
+	if remove {
+		m.s.statusMsg = "removed tag '" + tag + "' from " + strconv.Itoa(len(cmdLines)) + " command(s)"
+	} else {
+		m.s.statusMsg = "tagged " + strconv.Itoa(len(cmdLines)) + " command(s) with '" + tag + "'"
+	}
+	m.s.lock.Unlock()
+	m.UpdateData(inputBuffer(g))
+}
+
+// EditCommand opens inline editor with the highlighted command line
+func (m manager) EditCommand(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if m.s.highlightedItem >= len(m.s.data) {
+		return nil
+	}
+	m.s.editCmdLine = m.s.data[m.s.highlightedItem].cmdLine
+	m.s.modal = modalEdit
+	return nil
+}
+
+// EditExecute executes the command line from the inline editor
+func (m manager) EditExecute(g *gocui.Gui, v *gocui.View) error {
+	return m.selectEdited(v, exitCodeExecute, queryhist.ActionEditExecute)
+}
+
+// EditPaste pastes the command line from the inline editor
+func (m manager) EditPaste(g *gocui.Gui, v *gocui.View) error {
+	return m.selectEdited(v, 0, queryhist.ActionEditPaste)
+}
+
+func (m manager) selectEdited(v *gocui.View, exitCode int, action string) error {
+	cmdLine := strings.TrimRight(v.Buffer(), "\n")
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if strings.TrimSpace(cmdLine) == "" {
+		m.s.modal = modalNone
+		return nil
+	}
+	m.pick(action)
+	m.s.output = cmdLine
+	m.s.exitCode = exitCode
+	return gocui.ErrQuit
+}
+
+// cdCmdLine returns "cd <dir> && <cmd>" for the item
+func cdCmdLine(itm item, shell string) string {
+	return "cd " + shellQuote(itm.pwd, shell) + " && " + itm.cmdLine
+}
+
+// shellQuote quotes the string for the shell (bash, zsh, fish) if needed
+func shellQuote(str, shell string) string {
+	safe := true
+	for _, r := range str {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || strings.ContainsRune("/._-+:@,%", r) {
+			continue
+		}
+		safe = false
+		break
+	}
+	if safe && str != "" {
+		return str
+	}
+	if shell == "fish" {
+		// fish only supports \\ and \' escapes in single quotes
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(str) + "'"
+	}
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+// ConfirmYes runs the action waiting for confirmation
+func (m manager) ConfirmYes(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	action := m.s.confirmAction
+	m.s.modal = modalNone
+	m.s.confirmAction = nil
+	m.s.lock.Unlock()
+	if action == nil {
+		return nil
+	}
+	err := action()
+	if err != nil {
+		log.Println("Action failed:", err)
+		m.s.lock.Lock()
+		m.s.statusMsg = "failed: " + err.Error()
+		m.s.lock.Unlock()
+	}
+	return nil
+}
+
+// CloseModal closes the confirmation dialog, the tag prompt, the inline editor or the search of past queries without doing anything
+func (m manager) CloseModal(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	m.s.modal = modalNone
+	m.s.confirmAction = nil
+	return nil
+}
+
+// layoutModal shows confirmation dialog or tag prompt
+//		expects the state to be locked
+func (m manager) layoutModal(g *gocui.Gui, maxX, maxY int) error {
+	var b byte
+	for _, name := range []string{modalConfirm, modalTag, modalEdit, modalQueries, queriesList} {
+		if name == m.s.modal || (name == queriesList && m.s.modal == modalQueries) {
+			continue
+		}
+		err := g.DeleteView(name)
+		if err != nil && gocui.IsUnknownView(err) == false {
+			return err
+		}
+	}
+	switch m.s.modal {
+	case modalConfirm:
+		width := len([]rune(m.s.confirmQuestion)) + 2
+		if width > maxX-2 {
+			width = maxX - 2
+		}
+		x0 := (maxX - width) / 2
+		v, err := g.SetView(modalConfirm, x0, maxY/2-1, x0+width, maxY/2+1, b)
+		if err != nil && gocui.IsUnknownView(err) == false {
+			return err
+		}
+		v.Title = "confirm"
+		v.Clear()
+		v.WriteString(m.s.confirmQuestion)
+		g.SetCurrentView(modalConfirm)
+	case modalTag:
+		width := 40
+		if width > maxX-2 {
+			width = maxX - 2
+		}
+		x0 := (maxX - width) / 2
+		v, err := g.SetView(modalTag, x0, maxY/2-1, x0+width, maxY/2+1, b)
+		if err != nil && gocui.IsUnknownView(err) == false {
+			return err
+		}
+		if err != nil {
+			// new view
+			v.Editable = true
+		}
+		v.Title = "tag (prefix with '-' to remove)"
+		g.SetCurrentView(modalTag)
+	case modalEdit:
+		lines := strings.Split(m.s.editCmdLine, "\n")
+		height := len(lines) + 1
+		if height > maxY-4 {
+			height = maxY - 4
+		}
+		y0 := (maxY - height) / 2
+		v, err := g.SetView(modalEdit, 1, y0, maxX-2, y0+height, b)
+		if err != nil && gocui.IsUnknownView(err) == false {
+			return err
+		}
+		if err != nil {
+			// new view
+			v.Editable = true
+			v.WriteString(m.s.editCmdLine)
+			v.SetCursor(len([]rune(lines[len(lines)-1])), len(lines)-1)
+		}
+		v.Title = "edit command (enter to execute, tab to paste, esc to cancel)"
+		g.SetCurrentView(modalEdit)
+	case modalQueries:
+		return m.layoutQueries(g, maxX, maxY)
+	default:
+		g.SetCurrentView("input")
+	}
+	return nil
+}
+
+func hasTag(cmdTags []string, tag string) bool {
+	for _, cmdTag := range cmdTags {
+		if cmdTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func updateTags(cmdTags []string, tag string, remove bool) []string {
+	var newTags []string
+	for _, cmdTag := range cmdTags {
+		if cmdTag != tag {
+			newTags = append(newTags, cmdTag)
+		}
+	}
+	if remove == false {
+		newTags = append(newTags, tag)
+	}
+	return newTags
+}
+
+func sendMsg(path string, m interface{}, port string) ([]byte, error) {
+	recJSON, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Post("http://localhost:"+port+path, "application/json", bytes.NewBuffer(recJSON))
+	if err != nil {
+		return nil, errors.New("resh-daemon is not running")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func sendDeleteMsg(m msg.DeleteMsg, port string) (msg.DeleteResponse, error) {
+	response := msg.DeleteResponse{}
+	body, err := sendMsg("/delete", m, port)
+	if err != nil {
+		return response, err
+	}
+	err = json.Unmarshal(body, &response)
+	return response, err
+}
+
+func sendTagMsg(m msg.TagMsg, port string) error {
+	_, err := sendMsg("/tag", m, port)
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/curusarn/resh/pkg/cfg"
+	"github.com/curusarn/resh/pkg/collect"
+	"github.com/curusarn/resh/pkg/records"
+)
+
+// time distance is log10 of seconds between the records - 10 is more than 300 years
+const maxTimeDist = 10
+
+// contextScorer scores records by their distance from the current context
+type contextScorer struct {
+	// record describing the current context
+	current records.EnrichedRecord
+	params  records.DistParams
+	weight  float64
+	maxDist float64
+}
+
+func newContextScorer(scopeCtx scopeContext, machineID, login, shell string, extra map[string]string, weight float64, params records.DistParams) *contextScorer {
+	realPwd, err := filepath.EvalSymlinks(scopeCtx.pwd)
+	if err != nil {
+		realPwd = scopeCtx.pwd
+	}
+	current := records.EnrichedRecord{}
+	current.SessionID = scopeCtx.sessionID
+	current.Pwd = scopeCtx.pwd
+	current.RealPwd = realPwd
+	current.GitDir = scopeCtx.gitDir
+	current.GitRealDir = scopeCtx.gitRealDir
+	current.GitOriginRemote = scopeCtx.gitOriginRemote
+	current.GitBranch = scopeCtx.gitBranch
+	current.MachineID = machineID
+	current.Login = login
+	current.Shell = shell
+	current.Extra = extra
+	// exit code is zero so successful commands are closer
+	current.RealtimeBefore = float64(time.Now().Unix())
+
+	// maximal distance - DistanceTo() compares git dir, real dir, remote and branch separately
+	maxDist := params.ExitCode + params.MachineID + params.SessionID + params.Login + params.Shell +
+		params.Pwd + params.RealPwd + 4*params.Git + maxTimeDist*params.Time + params.Extra
+	return &contextScorer{current: current, params: params, weight: weight, maxDist: maxDist}
+}
+
+// currentExtra returns extra metadata of the current environment (resh-cli runs in the shell)
+func currentExtra(config cfg.Config) map[string]string {
+	collectors, err := collect.NewCollectors(config.Collectors, config.CollectEnv)
+	if err != nil {
+		log.Println("Collectors config error:", err)
+	}
+	return collect.CollectExtra(collectors, os.Environ())
+}
+
+// score returns weighted similarity of the record to the current context (from 0 to weight)
+func (c *contextScorer) score(rec *records.EnrichedRecord) float64 {
+	if c == nil || c.weight == 0 || c.maxDist <= 0 {
+		return 0
+	}
+	dist := c.current.DistanceTo(*rec, c.params)
+	similarity := 1 - math.Max(0, math.Min(dist, c.maxDist))/c.maxDist
+	return c.weight * similarity
+}
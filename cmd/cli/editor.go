@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// editLine edits single line views (query, past queries search)
+//		emacs line editing keys are handled here, other keys are passed to gocui.DefaultEditor
+//		ctrl-a/ctrl-e - start/end of line, ctrl-b/ctrl-f - back/forward, ctrl-d - delete character
+//		ctrl-k/ctrl-u - kill to end/start of line, ctrl-w - kill word before cursor, ctrl-y - yank killed text
+func (m manager) editLine(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	if ch != 0 {
+		gocui.DefaultEditor.Edit(v, key, ch, mod)
+		return
+	}
+	line := []rune(strings.TrimRight(v.Buffer(), "\n"))
+	cx, _ := v.Cursor()
+	ox, _ := v.Origin()
+	pos := cx + ox
+	if pos > len(line) {
+		pos = len(line)
+	}
+	m.s.lock.Lock()
+	killed := m.s.killed
+	m.s.lock.Unlock()
+
+	switch key {
+	case gocui.KeyCtrlA:
+		pos = 0
+	case gocui.KeyCtrlE:
+		pos = len(line)
+	case gocui.KeyCtrlB:
+		if pos > 0 {
+			pos--
+		}
+	case gocui.KeyCtrlF:
+		if pos < len(line) {
+			pos++
+		}
+	case gocui.KeyCtrlD:
+		if pos < len(line) {
+			line = append(line[:pos:pos], line[pos+1:]...)
+		}
+	case gocui.KeyCtrlK:
+		killed = string(line[pos:])
+		line = line[:pos]
+	case gocui.KeyCtrlU:
+		killed = string(line[:pos])
+		line = line[pos:]
+		pos = 0
+	case gocui.KeyCtrlW:
+		start := pos
+		for start > 0 && unicode.IsSpace(line[start-1]) {
+			start--
+		}
+		for start > 0 && unicode.IsSpace(line[start-1]) == false {
+			start--
+		}
+		killed = string(line[start:pos])
+		line = append(line[:start:start], line[pos:]...)
+		pos = start
+	case gocui.KeyCtrlY:
+		yank := []rune(killed)
+		line = append(line[:pos:pos], append(yank, line[pos:]...)...)
+		pos += len(yank)
+	default:
+		gocui.DefaultEditor.Edit(v, key, ch, mod)
+		return
+	}
+
+	m.s.lock.Lock()
+	m.s.killed = killed
+	m.s.lock.Unlock()
+	v.Clear()
+	v.WriteString(string(line))
+	// keep the cursor in the view
+	width, _ := v.Size()
+	ox = 0
+	if pos >= width {
+		ox = pos - width + 1
+	}
+	v.SetOrigin(ox, 0)
+	v.SetCursor(pos-ox, 0)
+}
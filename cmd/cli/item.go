@@ -0,0 +1,358 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/curusarn/resh/pkg/filter"
+	"github.com/curusarn/resh/pkg/fuzzy"
+	"github.com/curusarn/resh/pkg/records"
+)
+
+const dots = "…"
+
+func leftCutPadString(str string, newLen int) string {
+	strLen := len(str)
+	if newLen > strLen {
+		return strings.Repeat(" ", newLen-strLen) + str
+	} else if newLen < strLen {
+		return dots + str[strLen-newLen+1:]
+	}
+	return str
+}
+
+func rightCutPadString(str string, newLen int) string {
+	strLen := len(str)
+	if newLen > strLen {
+		return str + strings.Repeat(" ", newLen-strLen)
+	} else if newLen < strLen {
+		return str[:newLen-1] + dots
+	}
+	return str
+}
+
+// leftCutPadRunes works like leftCutPadString but keeps track of matched runes
+func leftCutPadRunes(runes []rune, matched []bool, newLen int) ([]rune, []bool) {
+	strLen := len(runes)
+	if newLen > strLen {
+		padding := []rune(strings.Repeat(" ", newLen-strLen))
+		return append(padding, runes...), append(make([]bool, len(padding)), matched...)
+	} else if newLen < strLen {
+		cut := strLen - newLen + 1
+		return append([]rune(dots), runes[cut:]...), append([]bool{false}, matched[cut:]...)
+	}
+	return runes, matched
+}
+
+func cleanHighlight(str string) string {
+	prefix := "\033["
+
+	invert := "\033[32;7;1m"
+	end := "\033[0m"
+	blueBold := "\033[34;1m"
+	redBold := "\033[31;1m"
+	repace := []string{invert, end, blueBold, redBold}
+	if strings.Contains(str, prefix) == false {
+		return str
+	}
+	for _, escSeq := range repace {
+		str = strings.ReplaceAll(str, escSeq, "")
+	}
+	return str
+}
+
+func highlightSelected(str string) string {
+	// template "\033[3%d;%dm"
+	invert := "\033[32;7;1m"
+	end := "\033[0m"
+	return invert + cleanHighlight(str) + end
+}
+
+func highlightMatchAlternative(str string) string {
+	// template "\033[3%d;%dm"
+	blueBold := "\033[34;1m"
+	end := "\033[0m"
+	return blueBold + cleanHighlight(str) + end
+}
+
+func highlightMatch(str string) string {
+	// template "\033[3%d;%dm"
+	redBold := "\033[31;1m"
+	end := "\033[0m"
+	return redBold + cleanHighlight(str) + end
+}
+
+// highlightMatchedRunes highlights runes marked as matched
+//		consecutive matched runes are highlighted together
+func highlightMatchedRunes(runes []rune, matched []bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && matched[j] == matched[i] {
+			j++
+		}
+		if matched[i] {
+			sb.WriteString(highlightMatch(string(runes[i:j])))
+		} else {
+			sb.WriteString(string(runes[i:j]))
+		}
+		i = j
+	}
+	return sb.String()
+}
+
+func toString(record records.EnrichedRecord, lineLength int) string {
+	dirColWidth := 24 // make this dynamic somehow
+	return leftCutPadString(strings.Replace(record.Pwd, record.Home, "~", 1), dirColWidth) + "   " +
+		rightCutPadString(strings.ReplaceAll(record.CmdLine, "\n", "; "), lineLength-dirColWidth-3) + "\n"
+}
+
+type query struct {
+	terms []string
+	// structured filters (e.g. "dir:~/proj", "exit:0")
+	filters filter.Query
+	// search is limited to a scope narrower than global
+	scoped bool
+	// scores records by their similarity to the current context (nil = no context score)
+	context *contextScorer
+	// score of the best possible match for each term - used for normalization
+	perfectScores []int
+	pwd           string
+	// pwdTilde string
+}
+
+func isValidTerm(term string) bool {
+	if len(term) == 0 {
+		return false
+	}
+	if strings.Contains(term, " ") {
+		return false
+	}
+	return true
+}
+
+func filterTerms(terms []string) []string {
+	var newTerms []string
+	for _, term := range terms {
+		if isValidTerm(term) {
+			newTerms = append(newTerms, term)
+		}
+	}
+	return newTerms
+}
+
+// newQueryFromString parses query input
+//		returns error if some of the filters is invalid - the rest of the query is still usable
+func newQueryFromString(queryInput string, ctx filter.Context) (query, error) {
+	log.Println("QUERY input = <" + queryInput + ">")
+	filters, err := filter.Parse(queryInput, ctx)
+	if err != nil {
+		log.Println("QUERY filter error:", err)
+	}
+	var logStr string
+	for _, f := range filters.Filters {
+		logStr += " <" + f.String() + ">"
+	}
+	log.Println("QUERY filters =" + logStr)
+	logStr = ""
+	for _, term := range filters.Terms {
+		logStr += " <" + term + ">"
+	}
+	log.Println("QUERY raw terms =" + logStr)
+	terms := filterTerms(filters.Terms)
+	logStr = ""
+	var perfectScores []int
+	for _, term := range terms {
+		logStr += " <" + term + ">"
+		perfectScores = append(perfectScores, fuzzy.PerfectScore(term))
+	}
+	log.Println("QUERY filtered terms =" + logStr)
+	log.Println("QUERY pwd =" + ctx.Pwd)
+	return query{terms: terms, filters: filters, perfectScores: perfectScores, pwd: ctx.Pwd}, err
+}
+
+type item struct {
+	// latest record for the command line and directory - used for preview
+	record         records.EnrichedRecord
+	display        string
+	displayNoColor string
+	cmdLine        string
+	pwd            string
+	pwdTilde       string
+	hits           float64
+	// computed from all runs of the command line in the directory
+	runCount int
+	lastRun  float64
+	frecency float64
+}
+
+func (i item) less(i2 item) bool {
+	// reversed order
+	return i.hits > i2.hits
+}
+
+// used for deduplication
+func (i item) key() string {
+	unlikelySeparator := "|||||"
+	return i.cmdLine + unlikelySeparator + i.pwd
+}
+
+// func (i item) equals(i2 item) bool {
+// 	return i.cmdLine == i2.cmdLine && i.pwd == i2.pwd
+// }
+
+// matchQuality returns fuzzy match score normalized to (0, 1]
+func matchQuality(res fuzzy.Result, perfectScore int) float64 {
+	const minQuality = 0.01
+	if perfectScore <= 0 {
+		return minQuality
+	}
+	quality := float64(res.Score) / float64(perfectScore)
+	if quality < minQuality {
+		return minQuality
+	}
+	if quality > 1 {
+		return 1
+	}
+	return quality
+}
+
+// markMatched marks matched positions
+func markMatched(matched []bool, res fuzzy.Result) {
+	for _, pos := range res.Positions {
+		matched[pos] = true
+	}
+}
+
+// newItemFromRecordForQuery creates new item from record based on given query
+//		returns error if the query doesn't match the record
+//		every term has to (fuzzy) match either the command or the directory
+//		every filter has to match the record
+func newItemFromRecordForQuery(record records.EnrichedRecord, query query, debug bool) (item, error) {
+	const hitScore = 1.0
+	const hitScoreConsecutive = 0.1
+	// scaled by quality of the fuzzy match (word boundaries, consecutive characters, ...)
+	const matchQualityScore = 0.3
+	const actualPwdScore = 0.9
+	const actualPwdScoreExtra = 0.2
+	const pwdColWidth = 25
+
+	if query.filters.Match(&record) == false {
+		return item{}, errors.New("record filtered out by the query")
+	}
+	hits := 0.0
+	// don't penalize failed commands when user explicitly filters by exit code
+	if record.Failed() && query.filters.HasFilter(filter.KeyExit) == false {
+		hits--
+	}
+	// query with filters (or narrowed scope) only matches all records that pass the filters
+	if len(query.terms) == 0 && (len(query.filters.Filters) > 0 || query.scoped) {
+		hits += hitScore
+	}
+	// replacing newlines keeps rune positions intact
+	cmd := []rune(strings.ReplaceAll(record.CmdLine, "\n", ";"))
+	cmdMatched := make([]bool, len(cmd))
+	pwdTilde := strings.Replace(record.Pwd, record.Home, "~", 1)
+	pwdTildeMatched := make([]bool, len([]rune(pwdTilde)))
+	pwdRawMatched := make([]bool, len([]rune(record.Pwd)))
+	var useRawPwd bool
+	var dirHit bool
+	for i, term := range query.terms {
+		termHit := false
+		if res, ok := fuzzy.Match(term, record.CmdLine); ok {
+			hits += hitScore + matchQualityScore*matchQuality(res, query.perfectScores[i])
+			termHit = true
+			markMatched(cmdMatched, res)
+			// NO continue
+		}
+		if res, ok := fuzzy.Match(term, pwdTilde); ok {
+			if termHit == false {
+				hits += hitScore + matchQualityScore*matchQuality(res, query.perfectScores[i])
+			} else {
+				hits += hitScoreConsecutive
+			}
+			termHit = true
+			markMatched(pwdTildeMatched, res)
+			dirHit = true
+		} else if res, ok := fuzzy.Match(term, record.Pwd); ok {
+			if termHit == false {
+				hits += hitScore + matchQualityScore*matchQuality(res, query.perfectScores[i])
+			} else {
+				hits += hitScoreConsecutive
+			}
+			termHit = true
+			markMatched(pwdRawMatched, res)
+			dirHit = true
+			useRawPwd = true
+		}
+		if termHit == false {
+			return item{}, errors.New("no match for given record and query")
+		}
+		// if strings.Contains(record.GitOriginRemote, term) {
+		// 	hits++
+		// }
+	}
+	pwdRunes, pwdMatched := leftCutPadRunes([]rune(pwdTilde), pwdTildeMatched, pwdColWidth)
+	pwdRawRunes, pwdRawMatched := leftCutPadRunes([]rune(record.Pwd), pwdRawMatched, pwdColWidth)
+	pwdDisp := highlightMatchedRunes(pwdRunes, pwdMatched)
+	pwdRawDisp := highlightMatchedRunes(pwdRawRunes, pwdRawMatched)
+	// actual pwd matches
+	// only use if there was no directory match on any of the terms
+	// N terms can only produce:
+	//		-> N matches against the command
+	//		-> N matches against the directory
+	//		-> 1 extra match for the actual directory match
+	if record.Pwd == query.pwd {
+		if dirHit {
+			hits += actualPwdScoreExtra
+		} else {
+			hits += actualPwdScore
+		}
+		pwdDisp = highlightMatchAlternative(pwdDisp)
+		// pwdRawDisp = highlightMatchAlternative(pwdRawDisp)
+		useRawPwd = false
+	}
+	if hits <= 0 {
+		return item{}, errors.New("no match for given record and query")
+	}
+	// context only changes the order of matching records
+	textHits := hits
+	contextHits := query.context.score(&record)
+	hits += contextHits
+	display := ""
+	// pwd := leftCutPadString("<"+pwdTilde+">", 20)
+	if useRawPwd {
+		display += pwdRawDisp
+	} else {
+		display += pwdDisp
+	}
+	if debug {
+		// score breakdown: text + context
+		hitsStr := fmt.Sprintf("%.1f+%.1f", textHits, contextHits)
+		hitsDisp := "  " + hitsStr + "  "
+		display += hitsDisp
+	} else {
+		display += "  "
+	}
+	display += highlightMatchedRunes(cmd, cmdMatched)
+
+	it := item{
+		record:         record,
+		display:        display,
+		displayNoColor: display,
+		cmdLine:        record.CmdLine,
+		pwd:            record.Pwd,
+		pwdTilde:       pwdTilde,
+		hits:           hits,
+	}
+	return it, nil
+}
+
+func doHighlightString(str string, minLength int) string {
+	if len(str) < minLength {
+		str = str + strings.Repeat(" ", minLength-len(str))
+	}
+	return highlightSelected(str)
+}
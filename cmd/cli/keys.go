@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/curusarn/resh/pkg/cfg"
+)
+
+// actions that can be bound to keys
+const (
+	actionNext          = "next"
+	actionPrev          = "prev"
+	actionRecallNext    = "recall-next"
+	actionRecallPrev    = "recall-prev"
+	actionSearchQueries = "search-queries"
+	actionPageDown      = "page-down"
+	actionPageUp        = "page-up"
+	actionFirst         = "first"
+	actionLast          = "last"
+	actionExecute       = "execute"
+	actionPaste         = "paste"
+	actionCdExecute     = "cd-execute"
+	actionCdPaste       = "cd-paste"
+	actionEdit          = "edit"
+	actionMark          = "mark"
+	actionDelete        = "delete"
+	actionFavourite     = "favourite"
+	actionTag           = "tag"
+	actionPrint         = "print"
+	actionToggleScope   = "toggle-scope"
+	actionTogglePreview = "toggle-preview"
+	actionToggleSort    = "toggle-sort"
+	actionToggleTime    = "toggle-time"
+	actionAbort         = "abort"
+	actionNormalMode    = "normal-mode"
+	actionInsertMode    = "insert-mode"
+)
+
+// key presets
+const (
+	presetEmacs = "emacs"
+	presetVi    = "vi"
+)
+
+// key modes - only vi preset uses normal mode
+const (
+	modeInsert = "insert"
+	modeNormal = "normal"
+)
+
+// keymaps for each mode: action -> keys
+type keyPreset map[string]map[string][]string
+
+// emacsKeys - ctrl-a/e/b/f/d/k/u/w/y are left for line editing (see editLine())
+var emacsKeys = map[string][]string{
+	actionNext:          {"ctrl-n", "ctrl-j"},
+	actionPrev:          {"ctrl-p"},
+	actionRecallNext:    {"down"},
+	actionRecallPrev:    {"up"},
+	actionSearchQueries: {"ctrl-r"},
+	actionPageDown:      {"pgdn"},
+	actionPageUp:        {"pgup"},
+	actionFirst:         {"home"},
+	actionLast:          {"end"},
+	actionExecute:       {"enter"},
+	actionPaste:         {"right"},
+	actionEdit:          {"f2"},
+	actionCdExecute:     {"f3"},
+	actionCdPaste:       {"f4"},
+	actionFavourite:     {"f5"},
+	actionTag:           {"f6"},
+	actionPrint:         {"f7"},
+	actionDelete:        {"f8"},
+	actionToggleScope:   {"f9"},
+	actionTogglePreview: {"f10"},
+	actionToggleTime:    {"f12"},
+	actionMark:          {"tab"},
+	actionToggleSort:    {"ctrl-x"},
+	actionAbort:         {"ctrl-c", "ctrl-g"},
+}
+
+var presets = map[string]keyPreset{
+	presetEmacs: {
+		modeInsert: emacsKeys,
+	},
+	presetVi: {
+		modeInsert: {
+			actionNext:          {"ctrl-n", "ctrl-j"},
+			actionPrev:          {"ctrl-p", "ctrl-k"},
+			actionRecallNext:    {"down"},
+			actionRecallPrev:    {"up"},
+			actionSearchQueries: {"ctrl-r"},
+			actionPageDown:      {"pgdn"},
+			actionPageUp:        {"pgup"},
+			actionExecute:       {"enter"},
+			actionPaste:         {"right"},
+			actionCdExecute:     {"ctrl-w"},
+			actionCdPaste:       {"ctrl-v"},
+			actionEdit:          {"ctrl-e"},
+			actionMark:          {"tab"},
+			actionToggleScope:   {"ctrl-s"},
+			actionTogglePreview: {"ctrl-o"},
+			actionToggleSort:    {"ctrl-x"},
+			actionToggleTime:    {"ctrl-l"},
+			actionNormalMode:    {"esc"},
+			actionAbort:         {"ctrl-c"},
+		},
+		modeNormal: {
+			actionNext:          {"j", "ctrl-n", "ctrl-j"},
+			actionPrev:          {"k", "ctrl-p", "ctrl-k"},
+			actionRecallNext:    {"down"},
+			actionRecallPrev:    {"up"},
+			actionSearchQueries: {"ctrl-r"},
+			actionPageDown:      {"ctrl-d", "pgdn"},
+			actionPageUp:        {"ctrl-u", "pgup"},
+			actionFirst:         {"g", "home"},
+			actionLast:          {"G", "end"},
+			actionExecute:       {"enter"},
+			actionPaste:         {"l", "right"},
+			actionCdExecute:     {"w"},
+			actionCdPaste:       {"W"},
+			actionEdit:          {"e"},
+			actionMark:          {"tab", "m"},
+			actionDelete:        {"d"},
+			actionFavourite:     {"f"},
+			actionTag:           {"t"},
+			actionPrint:         {"y"},
+			actionToggleScope:   {"s"},
+			actionTogglePreview: {"p"},
+			actionToggleSort:    {"o"},
+			actionToggleTime:    {"c"},
+			actionInsertMode:    {"i", "a", "/"},
+			actionAbort:         {"q", "ctrl-c", "esc"},
+		},
+	},
+}
+
+// keyID identifies a key press
+type keyID struct {
+	key gocui.Key
+	ch  rune
+}
+
+// binding returns key in a format accepted by gocui.SetKeybinding()
+func (k keyID) binding() interface{} {
+	if k.ch != 0 {
+		return k.ch
+	}
+	return k.key
+}
+
+var namedKeys = map[string]gocui.Key{
+	"enter":     gocui.KeyEnter,
+	"tab":       gocui.KeyTab,
+	"esc":       gocui.KeyEsc,
+	"space":     gocui.KeySpace,
+	"backspace": gocui.KeyBackspace2,
+	"delete":    gocui.KeyDelete,
+	"insert":    gocui.KeyInsert,
+	"up":        gocui.KeyArrowUp,
+	"down":      gocui.KeyArrowDown,
+	"left":      gocui.KeyArrowLeft,
+	"right":     gocui.KeyArrowRight,
+	"home":      gocui.KeyHome,
+	"end":       gocui.KeyEnd,
+	"pgup":      gocui.KeyPgup,
+	"pgdn":      gocui.KeyPgdn,
+	"f1":        gocui.KeyF1,
+	"f2":        gocui.KeyF2,
+	"f3":        gocui.KeyF3,
+	"f4":        gocui.KeyF4,
+	"f5":        gocui.KeyF5,
+	"f6":        gocui.KeyF6,
+	"f7":        gocui.KeyF7,
+	"f8":        gocui.KeyF8,
+	"f9":        gocui.KeyF9,
+	"f10":       gocui.KeyF10,
+	"f11":       gocui.KeyF11,
+	"f12":       gocui.KeyF12,
+}
+
+// parseKey parses keys like "enter", "ctrl-n" or "j"
+func parseKey(spec string) (keyID, error) {
+	if key, found := namedKeys[strings.ToLower(spec)]; found {
+		return keyID{key: key}, nil
+	}
+	runes := []rune(spec)
+	if len(runes) == 1 {
+		return keyID{ch: runes[0]}, nil
+	}
+	lower := strings.ToLower(spec)
+	if strings.HasPrefix(lower, "ctrl-") && len(lower) == len("ctrl-")+1 {
+		c := lower[len(lower)-1]
+		if c >= 'a' && c <= 'z' {
+			// ctrl-a = 0x01, ..., ctrl-z = 0x1a
+			return keyID{key: gocui.Key(c - 'a' + 1)}, nil
+		}
+	}
+	return keyID{}, errors.New("unknown key '" + spec + "'")
+}
+
+var validActions = []string{
+	actionNext, actionPrev, actionRecallNext, actionRecallPrev, actionSearchQueries, actionPageDown, actionPageUp, actionFirst, actionLast,
+	actionExecute, actionPaste, actionCdExecute, actionCdPaste, actionEdit, actionMark, actionDelete, actionFavourite, actionTag, actionPrint,
+	actionToggleScope, actionTogglePreview, actionToggleSort, actionToggleTime, actionAbort, actionNormalMode, actionInsertMode,
+}
+
+func isValidAction(action string) bool {
+	for _, validAction := range validActions {
+		if action == validAction {
+			return true
+		}
+	}
+	return false
+}
+
+// keysFromConfig converts config value (string or list of strings) to list of keys
+func keysFromConfig(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		var keys []string
+		for _, item := range v {
+			key, ok := item.(string)
+			if ok == false {
+				return nil, false
+			}
+			keys = append(keys, key)
+		}
+		return keys, true
+	}
+	return nil, false
+}
+
+// buildKeymaps creates keymaps for each mode: key -> action
+//		preset is applied first and then overridden by keys from the config
+//		keys from the config replace preset keys for the action
+func buildKeymaps(config cfg.CliConfig) (string, map[string]map[keyID]string) {
+	presetName := strings.ToLower(config.KeyPreset)
+	if presetName == "" {
+		presetName = presetEmacs
+	}
+	preset, found := presets[presetName]
+	if found == false {
+		log.Println("Unknown key preset:", config.KeyPreset, "- using:", presetEmacs)
+		presetName = presetEmacs
+		preset = presets[presetEmacs]
+	}
+	overrides := map[string]map[string][]string{}
+	for action, value := range config.Keys {
+		if action == modeNormal {
+			table, ok := value.(map[string]interface{})
+			if ok == false {
+				log.Println("Invalid keys for mode:", action)
+				continue
+			}
+			overrides[modeNormal] = map[string][]string{}
+			for normalAction, normalValue := range table {
+				keys, ok := keysFromConfig(normalValue)
+				if ok == false {
+					log.Println("Invalid keys for action:", normalAction)
+					continue
+				}
+				overrides[modeNormal][normalAction] = keys
+			}
+			continue
+		}
+		keys, ok := keysFromConfig(value)
+		if ok == false {
+			log.Println("Invalid keys for action:", action)
+			continue
+		}
+		if overrides[modeInsert] == nil {
+			overrides[modeInsert] = map[string][]string{}
+		}
+		overrides[modeInsert][action] = keys
+	}
+
+	keymaps := map[string]map[keyID]string{}
+	for mode, presetKeys := range preset {
+		keymaps[mode] = map[keyID]string{}
+		// preset keys first so keys from the config win when the same key is used for multiple actions
+		for _, action := range sortedActions(presetKeys) {
+			if _, overridden := overrides[mode][action]; overridden {
+				continue
+			}
+			addKeys(keymaps[mode], action, presetKeys[action])
+		}
+		for _, action := range sortedActions(overrides[mode]) {
+			addKeys(keymaps[mode], action, overrides[mode][action])
+		}
+	}
+	return presetName, keymaps
+}
+
+func sortedActions(actionKeys map[string][]string) []string {
+	var actions []string
+	for action := range actionKeys {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+func addKeys(keymap map[keyID]string, action string, specs []string) {
+	if isValidAction(action) == false {
+		log.Println("Unknown action:", action)
+		return
+	}
+	for _, spec := range specs {
+		key, err := parseKey(spec)
+		if err != nil {
+			log.Println("Invalid key for action", action, "-", err)
+			continue
+		}
+		keymap[key] = action
+	}
+}
@@ -10,15 +10,19 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/awesome-gocui/gocui"
 	"github.com/curusarn/resh/pkg/cfg"
+	"github.com/curusarn/resh/pkg/collect"
 	"github.com/curusarn/resh/pkg/msg"
+	"github.com/curusarn/resh/pkg/queryhist"
 	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/scrubber"
+	"github.com/curusarn/resh/pkg/tags"
 
 	"os/user"
 	"path/filepath"
@@ -31,9 +35,18 @@ var version string
 // commit from git set during build
 var commit string
 
-// special constant recognized by RESH wrappers
+// special constants recognized by RESH wrappers
 const exitCodeExecute = 111
 
+// output is a newline-separated list of command lines that should be printed
+const exitCodePrint = 112
+
+// output is "cd <dir> && <cmd>" that should be executed
+const exitCodeCdExecute = 113
+
+// output is "cd <dir> && <cmd>" that should be pasted
+const exitCodeCdPaste = 114
+
 func main() {
 	output, exitCode := runReshCli()
 	fmt.Print(output)
@@ -45,6 +58,9 @@ func runReshCli() (string, int) {
 	dir := usr.HomeDir
 	configPath := filepath.Join(dir, "/.config/resh.toml")
 	logPath := filepath.Join(dir, ".resh/cli.log")
+	settingsPath := filepath.Join(dir, ".resh/cli-settings.json")
+	queryHistPath := filepath.Join(dir, ".resh/cli-queries.json")
+	machineIDPath := "/etc/machine-id"
 
 	f, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
@@ -65,350 +81,289 @@ func runReshCli() (string, int) {
 	sessionID := flag.String("sessionID", "", "resh generated session id")
 	pwd := flag.String("pwd", "", "present working directory")
 	query := flag.String("query", "", "search query")
+	nonInteractive := flag.Bool("non-interactive", false, "print top results of the query instead of showing the interactive search")
+	limit := flag.Int("limit", 10, "maximum number of results printed in non-interactive mode (0 = unlimited)")
+	format := flag.String("format", formatPlain, "output format of non-interactive mode: plain, tsv or json")
+	scopeFlag := flag.String("scope", "", "search scope: session, dir, subdirs, git, host or global (default from config)")
+	shell := flag.String("shell", "", "current shell (used for context ranking and quoting)")
+	sortFlag := flag.String("sort", "", "sort order: relevance, recent, frequent or frecency (default: last used order or relevance in non-interactive mode)")
 	flag.Parse()
 
-	if *sessionID == "" {
-		fmt.Println("Error: you need to specify sessionId")
-	}
-	if *pwd == "" {
-		fmt.Println("Error: you need to specify PWD")
+	if *nonInteractive {
+		if isValidFormat(*format) == false {
+			fmt.Fprintln(os.Stderr, "resh-cli: unknown format '"+*format+"'")
+			return "", exitCodeError
+		}
+		if *sortFlag != "" && isValidSortOrder(*sortFlag) == false {
+			fmt.Fprintln(os.Stderr, "resh-cli: unknown sort order '"+*sortFlag+"'")
+			return "", exitCodeError
+		}
+	} else {
+		if *sessionID == "" {
+			fmt.Println("Error: you need to specify sessionId")
+		}
+		if *pwd == "" {
+			fmt.Println("Error: you need to specify PWD")
+		}
 	}
 
-	g, err := gocui.NewGui(gocui.OutputNormal, false)
+	mess := msg.DumpMsg{
+		SessionID: *sessionID,
+		PWD:       *pwd,
+	}
+	resp, err := SendDumpMsg(mess, strconv.Itoa(config.Port))
 	if err != nil {
-		log.Panicln(err)
+		if *nonInteractive {
+			fmt.Fprintln(os.Stderr, "resh-cli:", err)
+			return "", exitCodeError
+		}
+		log.Fatal(err)
 	}
-	defer g.Close()
 
-	g.Cursor = true
-	g.SelFgColor = gocui.ColorGreen
-	// g.SelBgColor = gocui.ColorGreen
-	g.Highlight = true
+	scope := config.Cli.DefaultScope
+	if *scopeFlag != "" {
+		scope = *scopeFlag
+	}
+	if scope == "" {
+		scope = scopeGlobal
+	}
+	if isValidScope(scope) == false {
+		log.Println("Unknown scope:", scope, "- using:", scopeGlobal)
+		scope = scopeGlobal
+	}
 
-	mess := msg.DumpMsg{
-		SessionID: *sessionID,
-		PWD:       *pwd,
+	keyPreset, keymaps := buildKeymaps(config.Cli)
+
+	cliSettings := loadSettings(settingsPath)
+	if *sortFlag != "" && isValidSortOrder(*sortFlag) {
+		cliSettings.SortOrder = *sortFlag
 	}
-	resp := SendDumpMsg(mess, strconv.Itoa(config.Port))
 
 	st := state{
 		// lock sync.Mutex
 		fullRecords:  resp.FullRecords,
+		cmdStats:     computeCmdStats(resp.FullRecords),
+		index:        newSearchIndex(resp.FullRecords),
+		marked:       map[string]item{},
+		scope:        scope,
+		keyMode:      modeInsert,
+		sortOrder:    cliSettings.SortOrder,
+		showTime:     cliSettings.ShowTime,
 		initialQuery: *query,
+		recallIdx:    -1,
+	}
+
+	scopeCtx := newScopeContext(*sessionID, *pwd)
+	scopeCtx.sessionParents = sessionParents(resp.FullRecords)
+	machineID := collect.ReadFileContent(machineIDPath)
+	contextScore := newContextScorer(scopeCtx, machineID, usr.Username, *shell,
+		currentExtra(config), config.Cli.ContextWeight, config.Cli.ContextDistParams)
+
+	// saved queries are scrubbed the same way as the history
+	var queryScrubber *scrubber.Scrubber
+	if config.Scrub.Enabled {
+		queryScrubber, err = scrubber.New(config.Scrub)
+		if err != nil {
+			log.Println("Error in scrub config - saved queries won't be scrubbed:", err)
+		}
 	}
 
 	layout := manager{
-		sessionID: *sessionID,
-		pwd:       *pwd,
-		config:    config,
-		s:         &st,
+		sessionID:     *sessionID,
+		pwd:           *pwd,
+		home:          dir,
+		shell:         *shell,
+		scopeCtx:      scopeCtx,
+		keyPreset:     keyPreset,
+		keymaps:       keymaps,
+		config:        config,
+		settings:      settingsPath,
+		queryHistPath: queryHistPath,
+		scrubber:      queryScrubber,
+		context:       contextScore,
+		s:             &st,
+	}
+
+	if *nonInteractive {
+		// non-interactive mode doesn't use the last used order so that the output is predictable
+		order := *sortFlag
+		if order == "" {
+			order = sortRelevance
+		}
+		var out strings.Builder
+		exitCode := layout.runNonInteractive(&out, *query, *format, order, *limit)
+		return out.String(), exitCode
 	}
-	g.SetManager(layout)
 
-	if err := g.SetKeybinding("", gocui.KeyTab, gocui.ModNone, layout.Next); err != nil {
+	g, err := gocui.NewGui(gocui.OutputNormal, false)
+	if err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("", gocui.KeyArrowDown, gocui.ModNone, layout.Next); err != nil {
-		log.Panicln(err)
+	defer g.Close()
+
+	g.Cursor = true
+	g.SelFgColor = gocui.ColorGreen
+	// g.SelBgColor = gocui.ColorGreen
+	g.Highlight = true
+
+	layout.g = g
+	pastEntries, err := queryhist.Load(queryHistPath)
+	if err != nil {
+		log.Println("Failed to load query history:", err)
 	}
-	if err := g.SetKeybinding("", gocui.KeyArrowUp, gocui.ModNone, layout.Prev); err != nil {
-		log.Panicln(err)
+	st.pastQueries = queryhist.Queries(pastEntries)
+	g.SetManager(layout)
+
+	actions := map[string]func(*gocui.Gui, *gocui.View) error{
+		actionNext:          layout.Next,
+		actionPrev:          layout.Prev,
+		actionRecallNext:    layout.RecallNext,
+		actionRecallPrev:    layout.RecallPrev,
+		actionSearchQueries: layout.SearchQueries,
+		actionPageDown:      layout.PageDown,
+		actionPageUp:        layout.PageUp,
+		actionFirst:         layout.First,
+		actionLast:          layout.Last,
+		actionExecute:       layout.SelectExecute,
+		actionPaste:         layout.SelectPaste,
+		actionCdExecute:     layout.SelectCdExecute,
+		actionCdPaste:       layout.SelectCdPaste,
+		actionEdit:          layout.EditCommand,
+		actionMark:          layout.ToggleMark,
+		actionDelete:        layout.Delete,
+		actionFavourite:     layout.ToggleFavourite,
+		actionTag:           layout.Tag,
+		actionPrint:         layout.PrintMarked,
+		actionToggleScope:   layout.ToggleScope,
+		actionTogglePreview: layout.TogglePreview,
+		actionToggleSort:    layout.ToggleSort,
+		actionToggleTime:    layout.ToggleTime,
+		actionAbort:         quit,
+		actionNormalMode:    layout.NormalMode,
+		actionInsertMode:    layout.InsertMode,
+	}
+	// every key is bound once - action is looked up based on the current mode
+	boundKeys := map[keyID]bool{}
+	for _, keymap := range layout.keymaps {
+		for key := range keymap {
+			if boundKeys[key] {
+				continue
+			}
+			boundKeys[key] = true
+			if err := g.SetKeybinding("input", key.binding(), gocui.ModNone, layout.keyHandler(key, actions)); err != nil {
+				log.Panicln(err)
+			}
+		}
 	}
 	if err := g.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, quit); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("", gocui.KeyEnter, gocui.ModNone, layout.SelectExecute); err != nil {
+	if err := g.SetKeybinding(modalConfirm, 'y', gocui.ModNone, layout.ConfirmYes); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("", gocui.KeyArrowRight, gocui.ModNone, layout.SelectPaste); err != nil {
+	if err := g.SetKeybinding(modalConfirm, 'n', gocui.ModNone, layout.CloseModal); err != nil {
 		log.Panicln(err)
 	}
-
-	layout.UpdateData(*query)
-	err = g.MainLoop()
-	if err != nil && gocui.IsQuit(err) == false {
+	if err := g.SetKeybinding(modalConfirm, gocui.KeyEnter, gocui.ModNone, layout.CloseModal); err != nil {
 		log.Panicln(err)
 	}
-	return layout.s.output, layout.s.exitCode
-}
-
-func leftCutPadString(str string, newLen int) string {
-	dots := "…"
-	strLen := len(str)
-	if newLen > strLen {
-		return strings.Repeat(" ", newLen-strLen) + str
-	} else if newLen < strLen {
-		return dots + str[strLen-newLen+1:]
+	if err := g.SetKeybinding(modalConfirm, gocui.KeyEsc, gocui.ModNone, layout.CloseModal); err != nil {
+		log.Panicln(err)
 	}
-	return str
-}
-
-func rightCutPadString(str string, newLen int) string {
-	dots := "…"
-	strLen := len(str)
-	if newLen > strLen {
-		return str + strings.Repeat(" ", newLen-strLen)
-	} else if newLen < strLen {
-		return str[:newLen-1] + dots
+	if err := g.SetKeybinding(modalTag, gocui.KeyEnter, gocui.ModNone, layout.TagConfirm); err != nil {
+		log.Panicln(err)
 	}
-	return str
-}
-
-func cleanHighlight(str string) string {
-	prefix := "\033["
-
-	invert := "\033[32;7;1m"
-	end := "\033[0m"
-	blueBold := "\033[34;1m"
-	redBold := "\033[31;1m"
-	repace := []string{invert, end, blueBold, redBold}
-	if strings.Contains(str, prefix) == false {
-		return str
+	if err := g.SetKeybinding(modalTag, gocui.KeyEsc, gocui.ModNone, layout.CloseModal); err != nil {
+		log.Panicln(err)
 	}
-	for _, escSeq := range repace {
-		str = strings.ReplaceAll(str, escSeq, "")
+	if err := g.SetKeybinding(modalEdit, gocui.KeyEnter, gocui.ModNone, layout.EditExecute); err != nil {
+		log.Panicln(err)
 	}
-	return str
-}
-
-func highlightSelected(str string) string {
-	// template "\033[3%d;%dm"
-	invert := "\033[32;7;1m"
-	end := "\033[0m"
-	return invert + cleanHighlight(str) + end
-}
-
-func highlightMatchAlternative(str string) string {
-	// template "\033[3%d;%dm"
-	blueBold := "\033[34;1m"
-	end := "\033[0m"
-	return blueBold + cleanHighlight(str) + end
-}
-
-func highlightMatch(str string) string {
-	// template "\033[3%d;%dm"
-	redBold := "\033[31;1m"
-	end := "\033[0m"
-	return redBold + cleanHighlight(str) + end
-}
-
-func toString(record records.EnrichedRecord, lineLength int) string {
-	dirColWidth := 24 // make this dynamic somehow
-	return leftCutPadString(strings.Replace(record.Pwd, record.Home, "~", 1), dirColWidth) + "   " +
-		rightCutPadString(strings.ReplaceAll(record.CmdLine, "\n", "; "), lineLength-dirColWidth-3) + "\n"
-}
-
-type query struct {
-	terms []string
-	pwd   string
-	// pwdTilde string
-}
-
-func isValidTerm(term string) bool {
-	if len(term) == 0 {
-		return false
+	if err := g.SetKeybinding(modalEdit, gocui.KeyTab, gocui.ModNone, layout.EditPaste); err != nil {
+		log.Panicln(err)
 	}
-	if strings.Contains(term, " ") {
-		return false
+	if err := g.SetKeybinding(modalEdit, gocui.KeyEsc, gocui.ModNone, layout.CloseModal); err != nil {
+		log.Panicln(err)
 	}
-	return true
-}
-
-func filterTerms(terms []string) []string {
-	var newTerms []string
-	for _, term := range terms {
-		if isValidTerm(term) {
-			newTerms = append(newTerms, term)
+	queriesBindings := map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter:     layout.QueriesSelect,
+		gocui.KeyEsc:       layout.CloseModal,
+		gocui.KeyArrowDown: layout.QueriesNext,
+		gocui.KeyCtrlN:     layout.QueriesNext,
+		gocui.KeyCtrlJ:     layout.QueriesNext,
+		gocui.KeyArrowUp:   layout.QueriesPrev,
+		gocui.KeyCtrlP:     layout.QueriesPrev,
+	}
+	for key, handler := range queriesBindings {
+		if err := g.SetKeybinding(modalQueries, key, gocui.ModNone, handler); err != nil {
+			log.Panicln(err)
 		}
 	}
-	return newTerms
-}
-
-func newQueryFromString(queryInput string, pwd string) query {
-	log.Println("QUERY input = <" + queryInput + ">")
-	terms := strings.Fields(queryInput)
-	var logStr string
-	for _, term := range terms {
-		logStr += " <" + term + ">"
-	}
-	log.Println("QUERY raw terms =" + logStr)
-	terms = filterTerms(terms)
-	logStr = ""
-	for _, term := range terms {
-		logStr += " <" + term + ">"
-	}
-	log.Println("QUERY filtered terms =" + logStr)
-	log.Println("QUERY pwd =" + pwd)
-	return query{terms: terms, pwd: pwd}
-}
-
-type item struct {
-	// record         records.EnrichedRecord
-	display        string
-	displayNoColor string
-	cmdLine        string
-	pwd            string
-	pwdTilde       string
-	hits           float64
-}
-
-func (i item) less(i2 item) bool {
-	// reversed order
-	return i.hits > i2.hits
-}
-
-// used for deduplication
-func (i item) key() string {
-	unlikelySeparator := "|||||"
-	return i.cmdLine + unlikelySeparator + i.pwd
-}
-
-// func (i item) equals(i2 item) bool {
-// 	return i.cmdLine == i2.cmdLine && i.pwd == i2.pwd
-// }
-
-// proper match for path is when whole directory is matched
-// proper match for command is when term matches word delimeted by whitespace
-func properMatch(str, term, padChar string) bool {
-	if strings.Contains(padChar+str+padChar, padChar+term+padChar) {
-		return true
-	}
-	return false
-}
 
-// newItemFromRecordForQuery creates new item from record based on given query
-//		returns error if the query doesn't match the record
-func newItemFromRecordForQuery(record records.EnrichedRecord, query query, debug bool) (item, error) {
-	// TODO: use color to highlight matches
-	const hitScore = 1.0
-	const hitScoreConsecutive = 0.1
-	const properMatchScore = 0.3
-	const actualPwdScore = 0.9
-	const actualPwdScoreExtra = 0.2
-
-	hits := 0.0
-	if record.ExitCode != 0 {
-		hits--
-	}
-	cmd := record.CmdLine
-	pwdTilde := strings.Replace(record.Pwd, record.Home, "~", 1)
-	pwdDisp := leftCutPadString(pwdTilde, 25)
-	pwdRawDisp := leftCutPadString(record.Pwd, 25)
-	var useRawPwd bool
-	var dirHit bool
-	for _, term := range query.terms {
-		termHit := false
-		if strings.Contains(record.CmdLine, term) {
-			if termHit == false {
-				hits += hitScore
-			} else {
-				hits += hitScoreConsecutive
-			}
-			termHit = true
-			if properMatch(cmd, term, " ") {
-				hits += properMatchScore
-			}
-			cmd = strings.ReplaceAll(cmd, term, highlightMatch(term))
-			// NO continue
-		}
-		if strings.Contains(pwdTilde, term) {
-			if termHit == false {
-				hits += hitScore
-			} else {
-				hits += hitScoreConsecutive
-			}
-			termHit = true
-			if properMatch(pwdTilde, term, "/") {
-				hits += properMatchScore
-			}
-			pwdDisp = strings.ReplaceAll(pwdDisp, term, highlightMatch(term))
-			pwdRawDisp = strings.ReplaceAll(pwdRawDisp, term, highlightMatch(term))
-			dirHit = true
-		} else if strings.Contains(record.Pwd, term) {
-			if termHit == false {
-				hits += hitScore
-			} else {
-				hits += hitScoreConsecutive
-			}
-			termHit = true
-			if properMatch(pwdTilde, term, "/") {
-				hits += properMatchScore
-			}
-			pwdRawDisp = strings.ReplaceAll(pwdRawDisp, term, highlightMatch(term))
-			dirHit = true
-			useRawPwd = true
-		}
-		// if strings.Contains(record.GitOriginRemote, term) {
-		// 	hits++
-		// }
-	}
-	// actual pwd matches
-	// only use if there was no directory match on any of the terms
-	// N terms can only produce:
-	//		-> N matches against the command
-	//		-> N matches against the directory
-	//		-> 1 extra match for the actual directory match
-	if record.Pwd == query.pwd {
-		if dirHit {
-			hits += actualPwdScoreExtra
-		} else {
-			hits += actualPwdScore
-		}
-		pwdDisp = highlightMatchAlternative(pwdDisp)
-		// pwdRawDisp = highlightMatchAlternative(pwdRawDisp)
-		useRawPwd = false
-	}
-	if hits <= 0 {
-		return item{}, errors.New("no match for given record and query")
-	}
-	display := ""
-	// pwd := leftCutPadString("<"+pwdTilde+">", 20)
-	if useRawPwd {
-		display += pwdRawDisp
-	} else {
-		display += pwdDisp
-	}
-	if debug {
-		hitsStr := fmt.Sprintf("%.1f", hits)
-		hitsDisp := "  " + hitsStr + "  "
-		display += hitsDisp
-	} else {
-		display += "  "
-	}
-	// cmd := "<" + strings.ReplaceAll(record.CmdLine, "\n", ";") + ">"
-	cmd = strings.ReplaceAll(cmd, "\n", ";")
-	display += cmd
-	// itDummy := item{
-	// 	cmdLine: record.CmdLine,
-	// 	pwd:     record.Pwd,
-	// }
-	// + "   #K:<" + itDummy.key() + ">"
-
-	it := item{
-		display:        display,
-		displayNoColor: display,
-		cmdLine:        record.CmdLine,
-		pwd:            record.Pwd,
-		pwdTilde:       pwdTilde,
-		hits:           hits,
-	}
-	return it, nil
-}
-
-func doHighlightString(str string, minLength int) string {
-	if len(str) < minLength {
-		str = str + strings.Repeat(" ", minLength-len(str))
+	layout.UpdateData(*query)
+	err = g.MainLoop()
+	if err != nil && gocui.IsQuit(err) == false {
+		log.Panicln(err)
 	}
-	return highlightSelected(str)
+	layout.saveQuery()
+	return layout.s.output, layout.s.exitCode
 }
 
 type state struct {
 	lock            sync.Mutex
 	fullRecords     []records.EnrichedRecord
+	cmdStats        map[string]cmdStat
+	index           *searchIndex
 	data            []item
 	highlightedItem int
+	// index of the first item shown in the body view
+	viewOffset int
+	// number of items that fit into the body view - updated on every layout
+	bodyHeight int
 
 	initialQuery string
+	// error from parsing query filters - shown in the title
+	queryErr error
+	// ID of the latest search - older searches are cancelled
+	searchID uint64
+	// ID of the search which results are shown
+	shownSearchID uint64
+	searching     bool
+
+	showPreview bool
+	sortOrder   string
+	// show when the command was last run and how many times
+	showTime bool
+	// only records in the scope are searched
+	scope string
+	// insert or normal (vi preset only)
+	keyMode string
+	// text killed in the query (ctrl-k, ctrl-u, ctrl-w) - inserted back with ctrl-y
+	killed string
+
+	// marked items (multi-select) - lookup: item key -> item
+	marked map[string]item
+	// currently shown modal view (confirmation dialog or tag prompt)
+	modal           string
+	confirmQuestion string
+	confirmAction   func() error
+	// command line shown in the inline editor when it's opened
+	editCmdLine string
+	// query of the latest search
+	lastQuery string
+	// picked item - saved to query history
+	pickAction string
+	pickItem   item
+	pickRank   int
+	// past queries (newest first)
+	pastQueries []string
+	// index of recalled past query (-1 = no query is recalled)
+	recallIdx int
+	// past queries matching the search of past queries
+	queryMatches   []string
+	queryHighlight int
+	// result of the last action - shown in the title
+	statusMsg string
 
 	output   string
 	exitCode int
@@ -417,7 +372,21 @@ type state struct {
 type manager struct {
 	sessionID string
 	pwd       string
-	config    cfg.Config
+	home      string
+	shell     string
+	scopeCtx  scopeContext
+	keyPreset string
+	// lookup: mode -> key -> action
+	keymaps map[string]map[keyID]string
+	config  cfg.Config
+	g       *gocui.Gui
+	// path to the settings file
+	settings string
+	context  *contextScorer
+	// path to the query history file
+	queryHistPath string
+	// nil if scrubbing of secrets is disabled
+	scrubber *scrubber.Scrubber
 
 	s *state
 }
@@ -426,6 +395,7 @@ func (m manager) SelectExecute(g *gocui.Gui, v *gocui.View) error {
 	m.s.lock.Lock()
 	defer m.s.lock.Unlock()
 	if m.s.highlightedItem < len(m.s.data) {
+		m.pick(queryhist.ActionExecute)
 		m.s.output = m.s.data[m.s.highlightedItem].cmdLine
 		m.s.exitCode = exitCodeExecute
 		return gocui.ErrQuit
@@ -437,6 +407,7 @@ func (m manager) SelectPaste(g *gocui.Gui, v *gocui.View) error {
 	m.s.lock.Lock()
 	defer m.s.lock.Unlock()
 	if m.s.highlightedItem < len(m.s.data) {
+		m.pick(queryhist.ActionPaste)
 		m.s.output = m.s.data[m.s.highlightedItem].cmdLine
 		m.s.exitCode = 0 // success
 		return gocui.ErrQuit
@@ -444,71 +415,168 @@ func (m manager) SelectPaste(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
-func (m manager) UpdateData(input string) {
-	log.Println("EDIT start")
-	log.Println("len(fullRecords) =", len(m.s.fullRecords))
-	log.Println("len(data) =", len(m.s.data))
-	query := newQueryFromString(input, m.pwd)
-	var data []item
-	itemSet := make(map[string]bool)
+func (m manager) SelectCdExecute(g *gocui.Gui, v *gocui.View) error {
 	m.s.lock.Lock()
 	defer m.s.lock.Unlock()
-	for _, rec := range m.s.fullRecords {
-		itm, err := newItemFromRecordForQuery(rec, query, m.config.Debug)
-		if err != nil {
-			// records didn't match the query
-			// log.Println(" * continue (no match)", rec.Pwd)
-			continue
-		}
-		if itemSet[itm.key()] {
-			// log.Println(" * continue (already present)", itm.key(), itm.pwd)
-			continue
-		}
-		itemSet[itm.key()] = true
-		data = append(data, itm)
-		// log.Println("DATA =", itm.display)
-	}
-	log.Println("len(tmpdata) =", len(data))
-	sort.SliceStable(data, func(p, q int) bool {
-		return data[p].hits > data[q].hits
-	})
-	m.s.data = nil
-	for _, itm := range data {
-		if len(m.s.data) > 420 {
-			break
-		}
-		m.s.data = append(m.s.data, itm)
+	if m.s.highlightedItem < len(m.s.data) {
+		m.pick(queryhist.ActionCdExecute)
+		m.s.output = cdCmdLine(m.s.data[m.s.highlightedItem], m.shell)
+		m.s.exitCode = exitCodeCdExecute
+		return gocui.ErrQuit
 	}
-	m.s.highlightedItem = 0
-	log.Println("len(fullRecords) =", len(m.s.fullRecords))
-	log.Println("len(data) =", len(m.s.data))
-	log.Println("EDIT end")
+	return nil
+}
+
+func (m manager) SelectCdPaste(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if m.s.highlightedItem < len(m.s.data) {
+		m.pick(queryhist.ActionCdPaste)
+		m.s.output = cdCmdLine(m.s.data[m.s.highlightedItem], m.shell)
+		m.s.exitCode = exitCodeCdPaste
+		return gocui.ErrQuit
+	}
+	return nil
 }
 
 func (m manager) Edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
-	gocui.DefaultEditor.Edit(v, key, ch, mod)
+	m.editLine(v, key, ch, mod)
+	m.s.lock.Lock()
+	m.s.statusMsg = ""
+	// edited query is not recalled anymore
+	m.s.recallIdx = -1
+	m.s.lock.Unlock()
 	m.UpdateData(v.Buffer())
 }
 
-func (m manager) Next(g *gocui.Gui, v *gocui.View) error {
-	_, y := g.Size()
+// moveHighlight moves highlighted item by given number of items and keeps it in bounds
+func (m manager) moveHighlight(by int) {
 	m.s.lock.Lock()
 	defer m.s.lock.Unlock()
-	if m.s.highlightedItem < y {
-		m.s.highlightedItem++
+	m.s.highlightedItem += by
+	if m.s.highlightedItem >= len(m.s.data) {
+		m.s.highlightedItem = len(m.s.data) - 1
 	}
+	if m.s.highlightedItem < 0 {
+		m.s.highlightedItem = 0
+	}
+}
+
+func (m manager) pageSize() int {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if m.s.bodyHeight < 1 {
+		return 1
+	}
+	return m.s.bodyHeight
+}
+
+func (m manager) Next(g *gocui.Gui, v *gocui.View) error {
+	m.moveHighlight(1)
 	return nil
 }
 
 func (m manager) Prev(g *gocui.Gui, v *gocui.View) error {
+	m.moveHighlight(-1)
+	return nil
+}
+
+func (m manager) PageDown(g *gocui.Gui, v *gocui.View) error {
+	m.moveHighlight(m.pageSize())
+	return nil
+}
+
+func (m manager) PageUp(g *gocui.Gui, v *gocui.View) error {
+	m.moveHighlight(-m.pageSize())
+	return nil
+}
+
+func (m manager) First(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	m.s.highlightedItem = 0
+	return nil
+}
+
+func (m manager) Last(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if len(m.s.data) > 0 {
+		m.s.highlightedItem = len(m.s.data) - 1
+	}
+	return nil
+}
+
+// keyHandler runs action bound to the key in the current mode
+//		keys without action in the current mode are passed to the editor
+func (m manager) keyHandler(key keyID, actions map[string]func(*gocui.Gui, *gocui.View) error) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		m.s.lock.Lock()
+		action, found := m.keymaps[m.s.keyMode][key]
+		m.s.lock.Unlock()
+		if found {
+			return actions[action](g, v)
+		}
+		if v != nil && v.Editable {
+			m.Edit(v, key.key, key.ch, gocui.ModNone)
+		}
+		return nil
+	}
+}
+
+func (m manager) NormalMode(g *gocui.Gui, v *gocui.View) error {
 	m.s.lock.Lock()
 	defer m.s.lock.Unlock()
-	if m.s.highlightedItem > 0 {
-		m.s.highlightedItem--
+	if _, found := m.keymaps[modeNormal]; found {
+		m.s.keyMode = modeNormal
 	}
 	return nil
 }
 
+func (m manager) InsertMode(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	m.s.keyMode = modeInsert
+	return nil
+}
+
+func (m manager) ToggleScope(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	m.s.scope = nextScope(m.s.scope)
+	m.s.lock.Unlock()
+	m.UpdateData(inputBuffer(g))
+	return nil
+}
+
+func (m manager) ToggleSort(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	m.s.sortOrder = nextSortOrder(m.s.sortOrder)
+	m.saveSettings()
+	m.s.lock.Unlock()
+	m.UpdateData(inputBuffer(g))
+	return nil
+}
+
+func (m manager) ToggleTime(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	m.s.showTime = !m.s.showTime
+	m.saveSettings()
+	return nil
+}
+
+// saveSettings expects the state to be locked
+func (m manager) saveSettings() {
+	saveSettings(m.settings, settings{SortOrder: m.s.sortOrder, ShowTime: m.s.showTime})
+}
+
+func (m manager) TogglePreview(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	m.s.showPreview = !m.s.showPreview
+	return nil
+}
+
 func (m manager) Layout(g *gocui.Gui) error {
 	var b byte
 	maxX, maxY := g.Size()
@@ -518,21 +586,67 @@ func (m manager) Layout(g *gocui.Gui) error {
 		log.Panicln(err.Error())
 	}
 
-	v.Editable = true
 	v.Editor = m
-	v.Title = "resh cli"
-
-	g.SetCurrentView("input")
-
 	m.s.lock.Lock()
 	defer m.s.lock.Unlock()
+	// char keys are only bound to actions when the input is not editable
+	v.Editable = m.s.keyMode != modeNormal
+	v.Title = "resh cli [" + scopeTitles[m.s.scope] + "]"
+	if m.s.sortOrder != sortRelevance {
+		v.Title += " sorted by " + m.s.sortOrder
+	}
+	if m.keyPreset == presetVi {
+		v.Title += " -- " + strings.ToUpper(m.s.keyMode) + " --"
+	}
+	if m.s.queryErr != nil {
+		v.Title += " - " + m.s.queryErr.Error()
+	} else if m.s.statusMsg != "" {
+		v.Title += " - " + m.s.statusMsg
+	}
+	if len(m.s.marked) > 0 {
+		v.Title += " - " + strconv.Itoa(len(m.s.marked)) + " marked"
+	}
+	if len(m.s.data) == 0 {
+		v.Subtitle = "no results"
+	} else {
+		v.Subtitle = strconv.Itoa(m.s.highlightedItem+1) + " of " + strconv.Itoa(len(m.s.data)) + " results"
+	}
+	if m.s.searching {
+		v.Subtitle = "searching ... " + v.Subtitle
+	}
 	if len(m.s.initialQuery) > 0 {
 		v.WriteString(m.s.initialQuery)
 		v.SetCursor(len(m.s.initialQuery), 0)
 		m.s.initialQuery = ""
 	}
 
-	v, err = g.SetView("body", 0, 2, maxX-1, maxY, b)
+	bodyMaxY := maxY
+	if m.s.showPreview && m.s.highlightedItem < len(m.s.data) {
+		itm := m.s.data[m.s.highlightedItem]
+		lines := previewLines(itm.record, m.s.cmdStats[itm.cmdLine])
+		// preview takes at most half of the screen
+		previewHeight := len(lines) + 2
+		if previewHeight > maxY/2 {
+			previewHeight = maxY / 2
+		}
+		bodyMaxY = maxY - previewHeight
+		pv, err := g.SetView("preview", 0, bodyMaxY, maxX-1, maxY-1, b)
+		if err != nil && gocui.IsUnknownView(err) == false {
+			log.Panicln(err.Error())
+		}
+		pv.Title = "preview"
+		pv.Wrap = true
+		pv.Clear()
+		pv.Rewind()
+		pv.WriteString(strings.Join(lines, "\n"))
+	} else {
+		err := g.DeleteView("preview")
+		if err != nil && gocui.IsUnknownView(err) == false {
+			log.Panicln(err.Error())
+		}
+	}
+
+	v, err = g.SetView("body", 0, 2, maxX-1, bodyMaxY, b)
 	if err != nil && gocui.IsUnknownView(err) == false {
 		log.Panicln(err.Error())
 	}
@@ -541,12 +655,32 @@ func (m manager) Layout(g *gocui.Gui) error {
 	v.Clear()
 	v.Rewind()
 
-	for i, itm := range m.s.data {
-		if i == maxY {
-			log.Println(maxY)
-			break
+	// keep highlighted item in the viewport
+	_, m.s.bodyHeight = v.Size()
+	if m.s.highlightedItem < m.s.viewOffset {
+		m.s.viewOffset = m.s.highlightedItem
+	}
+	if m.s.highlightedItem >= m.s.viewOffset+m.s.bodyHeight {
+		m.s.viewOffset = m.s.highlightedItem - m.s.bodyHeight + 1
+	}
+
+	now := time.Now()
+	// only render items in the viewport
+	for i := m.s.viewOffset; i < len(m.s.data) && i < m.s.viewOffset+m.s.bodyHeight; i++ {
+		itm := m.s.data[i]
+		gutter := " "
+		if _, found := m.s.marked[itm.key()]; found {
+			gutter = ">"
+		}
+		if hasTag(itm.record.Tags, tags.Favourite) {
+			gutter += "*"
+		} else {
+			gutter += " "
+		}
+		if m.s.showTime {
+			gutter += timeColumn(itm, now)
 		}
-		displayStr := itm.display
+		displayStr := gutter + itm.display
 		if m.s.highlightedItem == i {
 			// use actual min requried length instead of 420 constant
 			displayStr = doHighlightString(displayStr, 420)
@@ -565,7 +699,7 @@ func (m manager) Layout(g *gocui.Gui) error {
 	}
 	log.Println("len(data) =", len(m.s.data))
 	log.Println("highlightedItem =", m.s.highlightedItem)
-	return nil
+	return m.layoutModal(g, maxX, maxY)
 }
 
 func quit(g *gocui.Gui, v *gocui.View) error {
@@ -573,35 +707,35 @@ func quit(g *gocui.Gui, v *gocui.View) error {
 }
 
 // SendDumpMsg to daemon
-func SendDumpMsg(m msg.DumpMsg, port string) msg.DumpResponse {
+func SendDumpMsg(m msg.DumpMsg, port string) (msg.DumpResponse, error) {
+	response := msg.DumpResponse{}
 	recJSON, err := json.Marshal(m)
 	if err != nil {
-		log.Fatal("send err 1", err)
+		return response, errors.New("failed to marshal dump message: " + err.Error())
 	}
 
 	req, err := http.NewRequest("POST", "http://localhost:"+port+"/dump",
 		bytes.NewBuffer(recJSON))
 	if err != nil {
-		log.Fatal("send err 2", err)
+		return response, errors.New("failed to create dump request: " + err.Error())
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Fatal("resh-daemon is not running :(")
+		return response, errors.New("resh-daemon is not running :(")
 	}
 
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatal("read response error")
+		return response, errors.New("read response error: " + err.Error())
 	}
 	// log.Println(string(body))
-	response := msg.DumpResponse{}
 	err = json.Unmarshal(body, &response)
 	if err != nil {
-		log.Fatal("unmarshal resp error: ", err)
+		return response, errors.New("unmarshal resp error: " + err.Error())
 	}
-	return response
+	return response, nil
 }
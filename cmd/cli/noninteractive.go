@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// exit codes of the non-interactive mode (same as grep)
+const (
+	exitCodeMatch   = 0
+	exitCodeNoMatch = 1
+	exitCodeError   = 2
+)
+
+// output formats of the non-interactive mode
+const (
+	formatPlain = "plain"
+	formatTSV   = "tsv"
+	formatJSON  = "json"
+)
+
+func isValidFormat(format string) bool {
+	return format == formatPlain || format == formatTSV || format == formatJSON
+}
+
+// jsonItem is a single line of the json output
+type jsonItem struct {
+	CmdLine        string   `json:"cmdLine"`
+	Pwd            string   `json:"pwd"`
+	Score          float64  `json:"score"`
+	ExitCode       int      `json:"exitCode"`
+	PipeStatus     []int    `json:"pipeStatus,omitempty"`
+	RealtimeBefore float64  `json:"realtimeBefore"`
+	SessionID      string   `json:"sessionId"`
+	Host           string   `json:"host"`
+	RunCount       int      `json:"runCount"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// runNonInteractive searches the records and writes top results to out
+//		returns exit code that says whether anything matched
+func (m manager) runNonInteractive(out io.Writer, input, format, order string, limit int) int {
+	data, queryErr, _ := m.runSearch(input, m.s.fullRecords, m.s.index, m.s.scope, order, nil, nil)
+	if queryErr != nil {
+		log.Println("Invalid query:", queryErr)
+		fmt.Fprintln(os.Stderr, "resh-cli: invalid query:", queryErr)
+		return exitCodeError
+	}
+	if limit > 0 && len(data) > limit {
+		data = data[:limit]
+	}
+	for _, itm := range data {
+		line, err := m.formatItem(itm, format)
+		if err != nil {
+			log.Println("Failed to format item:", err)
+			fmt.Fprintln(os.Stderr, "resh-cli:", err)
+			return exitCodeError
+		}
+		fmt.Fprintln(out, line)
+	}
+	if len(data) == 0 {
+		return exitCodeNoMatch
+	}
+	return exitCodeMatch
+}
+
+// escapeOutput escapes tabs and newlines that would break lines and columns of the output
+var escapeOutput = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n")
+
+func (m manager) formatItem(itm item, format string) (string, error) {
+	switch format {
+	case formatTSV:
+		columns := []string{
+			escapeOutput.Replace(itm.cmdLine),
+			escapeOutput.Replace(itm.pwd),
+			strconv.FormatFloat(itm.hits, 'f', 2, 64),
+			strconv.Itoa(itm.record.ExitCode),
+			strconv.FormatFloat(itm.lastRun, 'f', 3, 64),
+			strconv.Itoa(itm.runCount),
+		}
+		return strings.Join(columns, "\t"), nil
+	case formatJSON:
+		line, err := json.Marshal(jsonItem{
+			CmdLine:        itm.cmdLine,
+			Pwd:            itm.pwd,
+			Score:          itm.hits,
+			ExitCode:       itm.record.ExitCode,
+			PipeStatus:     itm.record.PipeStatus,
+			RealtimeBefore: itm.lastRun,
+			SessionID:      itm.record.SessionID,
+			Host:           itm.record.Host,
+			RunCount:       itm.runCount,
+			Tags:           itm.record.Tags,
+		})
+		return string(line), err
+	case formatPlain:
+		// one result per line
+		return escapeOutput.Replace(itm.cmdLine), nil
+	}
+	return "", errors.New("unknown format '" + format + "'")
+}
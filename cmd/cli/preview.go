@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curusarn/resh/pkg/records"
+)
+
+type cmdStat struct {
+	runCount int
+	lastRun  float64
+}
+
+// computeCmdStats counts how many times each command line was run and when it was last run
+func computeCmdStats(fullRecords []records.EnrichedRecord) map[string]cmdStat {
+	stats := make(map[string]cmdStat)
+	for _, rec := range fullRecords {
+		stat := stats[rec.CmdLine]
+		stat.runCount++
+		if rec.RealtimeBefore > stat.lastRun {
+			stat.lastRun = rec.RealtimeBefore
+		}
+		stats[rec.CmdLine] = stat
+	}
+	return stats
+}
+
+func formatTimestamp(timestamp float64) string {
+	if timestamp == 0 {
+		return "unknown"
+	}
+	sec := int64(timestamp)
+	nsec := int64((timestamp - float64(sec)) * 1e9)
+	return time.Unix(sec, nsec).Format("2006-01-02 15:04:05")
+}
+
+func formatDuration(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+func tildePath(path, home string) string {
+	if home == "" {
+		return path
+	}
+	return strings.Replace(path, home, "~", 1)
+}
+
+// previewLines returns details of the record for the preview pane
+//		full (multi-line) command line is followed by record metadata
+func previewLines(record records.EnrichedRecord, stat cmdStat) []string {
+	lines := strings.Split(record.CmdLine, "\n")
+	lines = append(lines, "")
+
+	field := func(name, value string) {
+		if value == "" {
+			value = "-"
+		}
+		lines = append(lines, rightCutPadString(name+":", 12)+value)
+	}
+	exitCode := strconv.Itoa(record.ExitCode)
+	if len(record.PipeStatus) > 0 {
+		var statuses []string
+		for _, status := range record.PipeStatus {
+			statuses = append(statuses, strconv.Itoa(status))
+		}
+		exitCode += " (pipeline: " + strings.Join(statuses, " ") + ")"
+	}
+	field("exit code", exitCode)
+	field("started", formatTimestamp(record.RealtimeBefore))
+	field("duration", formatDuration(record.RealtimeDuration))
+	field("pwd", tildePath(record.Pwd, record.Home))
+	field("pwd after", tildePath(record.PwdAfter, record.Home))
+	field("git remote", record.GitOriginRemote)
+	if record.GitRealDir != "" {
+		commit := record.GitCommit
+		if len(commit) > 10 {
+			commit = commit[:10]
+		}
+		if record.GitDirty {
+			commit += " (dirty)"
+		}
+		field("git branch", record.GitBranch)
+		field("git commit", commit)
+	}
+	field("host", record.Host)
+	field("session", record.SessionID)
+	if record.ParentSessionID != "" {
+		field("parent", record.ParentSessionID)
+	}
+	if record.TmuxPane != "" {
+		field("tmux", strings.TrimSpace(record.TmuxSession+" "+record.TmuxWindow+" "+record.TmuxPane))
+	}
+	if record.SSHClient != "" {
+		field("ssh from", record.SSHClient)
+	}
+	field("tags", strings.Join(record.Tags, ", "))
+	field("runs", strconv.Itoa(stat.runCount)+" (last run "+formatTimestamp(stat.lastRun)+")")
+	var extraNames []string
+	for name := range record.Extra {
+		extraNames = append(extraNames, name)
+	}
+	sort.Strings(extraNames)
+	for _, name := range extraNames {
+		field(name, record.Extra[name])
+	}
+	return lines
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/curusarn/resh/pkg/fuzzy"
+	"github.com/curusarn/resh/pkg/queryhist"
+	"github.com/curusarn/resh/pkg/scrubber"
+)
+
+// list of past queries - input of the search is modalQueries view
+const queriesList = "queriesList"
+
+// maxSavedQueries - older queries are dropped from the query history file
+const maxSavedQueries = 10000
+
+// pick remembers which item was picked - saved to query history on exit
+//		expects the state to be locked
+func (m manager) pick(action string) {
+	m.s.pickAction = action
+	m.s.pickRank = -1
+	if action == queryhist.ActionPrint || m.s.highlightedItem >= len(m.s.data) {
+		return
+	}
+	m.s.pickItem = m.s.data[m.s.highlightedItem]
+	m.s.pickRank = m.s.highlightedItem
+}
+
+// saveQuery appends the search to the query history
+func (m manager) saveQuery() {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	action := m.s.pickAction
+	if action == "" {
+		action = queryhist.ActionAbort
+	}
+	entry := queryhist.Entry{
+		Query:       strings.TrimSpace(m.s.lastQuery),
+		Realtime:    float64(time.Now().UnixNano()) / 1e9,
+		SessionID:   m.sessionID,
+		Pwd:         m.pwd,
+		Scope:       m.s.scope,
+		SortOrder:   m.s.sortOrder,
+		ResultCount: len(m.s.data),
+		Action:      action,
+		Rank:        -1,
+	}
+	if action != queryhist.ActionAbort && m.s.pickRank >= 0 {
+		entry.PickedCmdLine = m.s.pickItem.cmdLine
+		entry.PickedPwd = m.s.pickItem.pwd
+		entry.Rank = m.s.pickRank
+	}
+	if m.scrubber != nil {
+		var detected, detectedPicked []string
+		entry.Query, detected = m.scrubber.ScrubCmdLine(entry.Query)
+		entry.PickedCmdLine, detectedPicked = m.scrubber.ScrubCmdLine(entry.PickedCmdLine)
+		if m.scrubber.Action() == scrubber.ActionDrop && len(detected)+len(detectedPicked) > 0 {
+			log.Println("Query not saved - secrets detected:", append(detected, detectedPicked...))
+			return
+		}
+	}
+	err := queryhist.Append(m.queryHistPath, entry, maxSavedQueries)
+	if err != nil {
+		log.Println("Failed to save query:", err)
+	}
+}
+
+// canRecall returns true if up/down should recall past queries instead of moving in results
+//		expects the state to be locked
+func (m manager) canRecall(buffer string) bool {
+	if m.s.recallIdx >= 0 {
+		// query was recalled and not edited since
+		return buffer == m.s.pastQueries[m.s.recallIdx]
+	}
+	return buffer == "" && m.s.highlightedItem == 0
+}
+
+// RecallPrev recalls older query when the query is empty (or recalled), otherwise it works as Prev
+func (m manager) RecallPrev(g *gocui.Gui, v *gocui.View) error {
+	buffer := strings.TrimRight(v.Buffer(), "\n")
+	m.s.lock.Lock()
+	if m.canRecall(buffer) == false {
+		m.s.lock.Unlock()
+		return m.Prev(g, v)
+	}
+	if m.s.recallIdx+1 >= len(m.s.pastQueries) {
+		m.s.lock.Unlock()
+		return nil
+	}
+	m.s.recallIdx++
+	query := m.s.pastQueries[m.s.recallIdx]
+	m.s.lock.Unlock()
+	m.setQuery(v, query)
+	return nil
+}
+
+// RecallNext recalls newer query when the query is recalled, otherwise it works as Next
+func (m manager) RecallNext(g *gocui.Gui, v *gocui.View) error {
+	buffer := strings.TrimRight(v.Buffer(), "\n")
+	m.s.lock.Lock()
+	if m.s.recallIdx < 0 || m.canRecall(buffer) == false {
+		m.s.lock.Unlock()
+		return m.Next(g, v)
+	}
+	m.s.recallIdx--
+	query := ""
+	if m.s.recallIdx >= 0 {
+		query = m.s.pastQueries[m.s.recallIdx]
+	}
+	m.s.lock.Unlock()
+	m.setQuery(v, query)
+	return nil
+}
+
+// setQuery replaces content of the input view and searches for the query
+func (m manager) setQuery(v *gocui.View, query string) {
+	v.Clear()
+	v.SetOrigin(0, 0)
+	v.WriteString(query)
+	v.SetCursor(len([]rune(query)), 0)
+	m.UpdateData(query)
+}
+
+// SearchQueries opens search of past queries
+func (m manager) SearchQueries(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	m.s.modal = modalQueries
+	m.s.queryMatches = m.s.pastQueries
+	m.s.queryHighlight = 0
+	return nil
+}
+
+// filterQueries shows past queries matching all terms of the input
+func (m manager) filterQueries(input string) {
+	terms := strings.Fields(input)
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	var matches []string
+	for _, query := range m.s.pastQueries {
+		matched := true
+		for _, term := range terms {
+			if _, ok := fuzzy.Match(term, query); ok == false {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, query)
+		}
+	}
+	m.s.queryMatches = matches
+	m.s.queryHighlight = 0
+}
+
+// QueriesNext highlights next past query
+func (m manager) QueriesNext(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if m.s.queryHighlight < len(m.s.queryMatches)-1 {
+		m.s.queryHighlight++
+	}
+	return nil
+}
+
+// QueriesPrev highlights previous past query
+func (m manager) QueriesPrev(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if m.s.queryHighlight > 0 {
+		m.s.queryHighlight--
+	}
+	return nil
+}
+
+// QueriesSelect uses highlighted past query as the query
+func (m manager) QueriesSelect(g *gocui.Gui, v *gocui.View) error {
+	m.s.lock.Lock()
+	m.s.modal = modalNone
+	if m.s.queryHighlight >= len(m.s.queryMatches) {
+		m.s.lock.Unlock()
+		return nil
+	}
+	query := m.s.queryMatches[m.s.queryHighlight]
+	m.s.recallIdx = -1
+	m.s.lock.Unlock()
+	input, err := g.View("input")
+	if err != nil {
+		return err
+	}
+	m.setQuery(input, query)
+	return nil
+}
+
+// layoutQueries shows search of past queries
+//		expects the state to be locked
+func (m manager) layoutQueries(g *gocui.Gui, maxX, maxY int) error {
+	var b byte
+	x0, x1 := maxX/8, maxX-maxX/8-1
+	y0, y1 := maxY/6, maxY-maxY/6-1
+	v, err := g.SetView(modalQueries, x0, y0, x1, y0+2, b)
+	if err != nil && gocui.IsUnknownView(err) == false {
+		return err
+	}
+	if err != nil {
+		// new view
+		v.Editable = true
+		v.Editor = gocui.EditorFunc(func(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+			m.editLine(v, key, ch, mod)
+			m.filterQueries(v.Buffer())
+		})
+	}
+	v.Title = "search past queries (enter to use, esc to cancel)"
+	lv, err := g.SetView(queriesList, x0, y0+2, x1, y1, b)
+	if err != nil && gocui.IsUnknownView(err) == false {
+		return err
+	}
+	lv.Clear()
+	_, height := lv.Size()
+	offset := 0
+	if m.s.queryHighlight >= height {
+		offset = m.s.queryHighlight - height + 1
+	}
+	for i := offset; i < len(m.s.queryMatches) && i < offset+height; i++ {
+		line := " " + strings.ReplaceAll(m.s.queryMatches[i], "\n", " ")
+		if i == m.s.queryHighlight {
+			line = doHighlightString(line, x1-x0)
+		}
+		lv.WriteString(line + "\n")
+	}
+	g.SetViewOnTop(queriesList)
+	g.SetViewOnTop(modalQueries)
+	g.SetCurrentView(modalQueries)
+	return nil
+}
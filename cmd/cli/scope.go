@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/curusarn/resh/pkg/collect"
+	"github.com/curusarn/resh/pkg/records"
+)
+
+// search scopes - values are used in the config
+const (
+	scopeSession = "session"
+	scopeDir     = "dir"
+	scopeSubdirs = "subdirs"
+	scopeGit     = "git"
+	scopeHost    = "host"
+	scopeGlobal  = "global"
+)
+
+// order in which the scopes are cycled
+var scopes = []string{scopeSession, scopeDir, scopeSubdirs, scopeGit, scopeHost, scopeGlobal}
+
+var scopeTitles = map[string]string{
+	scopeSession: "this session",
+	scopeDir:     "this directory",
+	scopeSubdirs: "this directory + subdirectories",
+	scopeGit:     "this git repository",
+	scopeHost:    "this host",
+	scopeGlobal:  "everything",
+}
+
+func isValidScope(scope string) bool {
+	_, found := scopeTitles[scope]
+	return found
+}
+
+func nextScope(scope string) string {
+	for i, s := range scopes {
+		if s == scope {
+			return scopes[(i+1)%len(scopes)]
+		}
+	}
+	return scopeGlobal
+}
+
+// scopeContext describes the current shell session
+type scopeContext struct {
+	sessionID       string
+	pwd             string
+	gitDir          string
+	gitRealDir      string
+	gitOriginRemote string
+	gitBranch       string
+	host            string
+	tmuxSession     string
+	tmuxWindow      string
+	tmuxPane        string
+	// lookup: session ID -> parent session ID
+	sessionParents map[string]string
+}
+
+func newScopeContext(sessionID, pwd string) scopeContext {
+	ctx := scopeContext{sessionID: sessionID, pwd: pwd}
+	host, err := os.Hostname()
+	if err != nil {
+		log.Println("Failed to get hostname:", err)
+	}
+	ctx.host = host
+
+	if git, found := collect.ReadGitInfo(pwd); found {
+		ctx.gitDir = git.Dir
+		ctx.gitRealDir = git.RealDir
+		ctx.gitOriginRemote = git.OriginRemote()
+		ctx.gitBranch = git.Branch
+	}
+	sessionInfo := collect.ReadSessionInfo(os.Environ())
+	ctx.tmuxSession = sessionInfo.TmuxSession
+	ctx.tmuxWindow = sessionInfo.TmuxWindow
+	ctx.tmuxPane = sessionInfo.TmuxPane
+	return ctx
+}
+
+// sessionParents returns parent sessions of all sessions in the records
+func sessionParents(fullRecords []records.EnrichedRecord) map[string]string {
+	parents := map[string]string{}
+	for _, rec := range fullRecords {
+		if rec.ParentSessionID != "" {
+			parents[rec.SessionID] = rec.ParentSessionID
+		}
+	}
+	return parents
+}
+
+// inScope returns true if the record belongs to the scope
+func (ctx scopeContext) inScope(scope string, rec *records.EnrichedRecord) bool {
+	switch scope {
+	case scopeSession:
+		return rec.SessionID == ctx.sessionID
+	case scopeDir:
+		return rec.Pwd == ctx.pwd
+	case scopeSubdirs:
+		return rec.Pwd == ctx.pwd || strings.HasPrefix(rec.Pwd, strings.TrimSuffix(ctx.pwd, "/")+"/")
+	case scopeGit:
+		if ctx.gitRealDir == "" {
+			// not in a git repository
+			return false
+		}
+		return rec.GitRealDir == ctx.gitRealDir ||
+			(ctx.gitOriginRemote != "" && rec.GitOriginRemote == ctx.gitOriginRemote)
+	case scopeHost:
+		return rec.Host == ctx.host
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/curusarn/resh/pkg/collect"
+	"github.com/curusarn/resh/pkg/filter"
+	"github.com/curusarn/resh/pkg/records"
+)
+
+// number of records searched between checks for cancellation and progressive rendering
+const searchChunkSize = 2000
+
+// searchIndex is an in-memory index of records used to skip records that can't match the query
+//		fuzzy match requires all characters of the term to be present in the command or the directory
+//		so only records that contain all characters of all terms are searched
+type searchIndex struct {
+	// lookup: lowercase rune -> indexes of records containing the rune (ascending)
+	postings map[rune][]int
+	size     int
+}
+
+func newSearchIndex(recs []records.EnrichedRecord) *searchIndex {
+	start := time.Now()
+	idx := searchIndex{postings: map[rune][]int{}, size: len(recs)}
+	for i, rec := range recs {
+		pwdTilde := strings.Replace(rec.Pwd, rec.Home, "~", 1)
+		text := rec.CmdLine + "\n" + rec.Pwd + "\n" + pwdTilde
+		seen := map[rune]bool{}
+		for _, r := range text {
+			r = unicode.ToLower(r)
+			if seen[r] {
+				continue
+			}
+			seen[r] = true
+			idx.postings[r] = append(idx.postings[r], i)
+		}
+	}
+	log.Println("Search index built - records:", len(recs), "; runes:", len(idx.postings), "; took:", time.Since(start))
+	return &idx
+}
+
+// candidates returns indexes of records that can match all terms (in ascending order)
+func (idx *searchIndex) candidates(terms []string) []int {
+	runes := map[rune]bool{}
+	for _, term := range terms {
+		for _, r := range term {
+			runes[unicode.ToLower(r)] = true
+		}
+	}
+	if len(runes) == 0 {
+		all := make([]int, idx.size)
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	var lists [][]int
+	for r := range runes {
+		list, found := idx.postings[r]
+		if found == false {
+			return nil
+		}
+		lists = append(lists, list)
+	}
+	// start with the shortest list to keep the intersections small
+	sort.Slice(lists, func(i, j int) bool {
+		return len(lists[i]) < len(lists[j])
+	})
+	result := lists[0]
+	for _, list := range lists[1:] {
+		result = intersect(result, list)
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+// intersect two ascending lists
+func intersect(a, b []int) []int {
+	var result []int
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			result = append(result, a[i])
+			i++
+			j++
+		} else if a[i] < b[j] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// UpdateData starts a new search in the background - search that is already running gets cancelled
+func (m manager) UpdateData(input string) {
+	m.s.lock.Lock()
+	m.s.searchID++
+	searchID := m.s.searchID
+	m.s.lastQuery = input
+	fullRecords := m.s.fullRecords
+	index := m.s.index
+	scope := m.s.scope
+	order := m.s.sortOrder
+	m.s.searching = true
+	m.s.lock.Unlock()
+	go m.search(searchID, input, fullRecords, index, scope, order)
+}
+
+func (m manager) isCancelled(searchID uint64) bool {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	return m.s.searchID != searchID
+}
+
+func (m manager) search(searchID uint64, input string, fullRecords []records.EnrichedRecord, index *searchIndex, scope, order string) {
+	cancelled := func() bool {
+		return m.isCancelled(searchID)
+	}
+	progress := func(data []item, queryErr error) {
+		m.publish(searchID, data, queryErr, false)
+	}
+	data, queryErr, ok := m.runSearch(input, fullRecords, index, scope, order, cancelled, progress)
+	if ok == false {
+		return
+	}
+	m.publish(searchID, data, queryErr, true)
+}
+
+// runSearch returns items matching the query in the scope sorted in given order
+//		cancelled is checked (and progress called with results found so far) after every chunk of records
+//		returns false if the search was cancelled
+func (m manager) runSearch(input string, fullRecords []records.EnrichedRecord, index *searchIndex, scope, order string,
+	cancelled func() bool, progress func([]item, error)) ([]item, error, bool) {
+
+	log.Println("SEARCH start")
+	start := time.Now()
+	ctx := filter.Context{
+		Now:       time.Now(),
+		SessionID: m.sessionID,
+		Home:      m.home,
+		Pwd:       m.pwd,
+
+		TmuxSession:    m.scopeCtx.tmuxSession,
+		TmuxWindow:     m.scopeCtx.tmuxWindow,
+		TmuxPane:       m.scopeCtx.tmuxPane,
+		SessionParents: m.scopeCtx.sessionParents,
+		ExtraKeys: map[string][]string{
+			filter.KeyVenv: {collect.ExtraVirtualenv, collect.ExtraConda},
+			filter.KeyKube: {collect.ExtraKubeContext},
+			filter.KeyAws:  {collect.ExtraAwsProfile},
+		},
+	}
+	query, queryErr := newQueryFromString(input, ctx)
+	query.scoped = scope != scopeGlobal
+	query.context = m.context
+	now := float64(ctx.Now.Unix())
+	candidates := index.candidates(query.terms)
+	log.Println("len(fullRecords) =", len(fullRecords), "; len(candidates) =", len(candidates))
+
+	var data []item
+	itemSet := make(map[string]int)
+	for i, recIdx := range candidates {
+		if i%searchChunkSize == 0 && i > 0 {
+			if cancelled != nil && cancelled() {
+				log.Println("SEARCH cancelled")
+				return nil, nil, false
+			}
+			if progress != nil {
+				// render results found so far
+				progress(sortItems(data, order), queryErr)
+			}
+		}
+		rec := fullRecords[recIdx]
+		if m.scopeCtx.inScope(scope, &rec) == false {
+			continue
+		}
+		itm, err := newItemFromRecordForQuery(rec, query, m.config.Debug)
+		if err != nil {
+			// records didn't match the query
+			continue
+		}
+		if idx, found := itemSet[itm.key()]; found {
+			if itm.hits > data[idx].hits {
+				// score of the command is given by its run closest to the current context
+				data[idx].hits = itm.hits
+				data[idx].display = itm.display
+				data[idx].displayNoColor = itm.displayNoColor
+			}
+			data[idx].runCount++
+			data[idx].frecency += frecencyWeight(now, rec.RealtimeBefore)
+			// show latest run in preview
+			if rec.RealtimeBefore > data[idx].record.RealtimeBefore {
+				data[idx].record = rec
+				data[idx].lastRun = rec.RealtimeBefore
+			}
+			continue
+		}
+		itm.runCount = 1
+		itm.lastRun = rec.RealtimeBefore
+		itm.frecency = frecencyWeight(now, rec.RealtimeBefore)
+		itemSet[itm.key()] = len(data)
+		data = append(data, itm)
+	}
+	log.Println("SEARCH end - len(data) =", len(data), "; took:", time.Since(start))
+	return sortItems(data, order), queryErr, true
+}
+
+// publish search results and redraw - results of cancelled searches are ignored
+func (m manager) publish(searchID uint64, data []item, queryErr error, done bool) {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	if m.s.searchID != searchID {
+		return
+	}
+	if m.s.shownSearchID != searchID {
+		// first results of the search
+		m.s.shownSearchID = searchID
+		m.s.highlightedItem = 0
+		m.s.viewOffset = 0
+	}
+	m.s.data = data
+	if m.s.highlightedItem >= len(data) {
+		m.s.highlightedItem = 0
+	}
+	m.s.queryErr = queryErr
+	m.s.searching = done == false
+	if m.g != nil {
+		m.g.Update(func(*gocui.Gui) error { return nil })
+	}
+}
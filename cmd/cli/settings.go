@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// settings chosen in resh-cli that persist between invocations
+type settings struct {
+	SortOrder string `json:"sortOrder"`
+	ShowTime  bool   `json:"showTime"`
+}
+
+func loadSettings(path string) settings {
+	s := settings{SortOrder: sortRelevance}
+	jsn, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			log.Println("Failed to read settings file:", err)
+		}
+		return s
+	}
+	err = json.Unmarshal(jsn, &s)
+	if err != nil {
+		log.Println("Failed to decode settings file:", err)
+	}
+	if isValidSortOrder(s.SortOrder) == false {
+		log.Println("Unknown sort order:", s.SortOrder, "- using:", sortRelevance)
+		s.SortOrder = sortRelevance
+	}
+	return s
+}
+
+func saveSettings(path string, s settings) {
+	jsn, err := json.Marshal(s)
+	if err != nil {
+		log.Println("Failed to encode settings:", err)
+		return
+	}
+	err = ioutil.WriteFile(path, jsn, 0644)
+	if err != nil {
+		log.Println("Failed to write settings file:", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sort orders - values are used in the settings file and in the --sort option
+const (
+	sortRelevance = "relevance"
+	sortRecent    = "recent"
+	sortFrequent  = "frequent"
+	sortFrecency  = "frecency"
+)
+
+// order in which the sort orders are cycled
+var sortOrders = []string{sortRelevance, sortRecent, sortFrequent, sortFrecency}
+
+func isValidSortOrder(order string) bool {
+	for _, o := range sortOrders {
+		if o == order {
+			return true
+		}
+	}
+	return false
+}
+
+func nextSortOrder(order string) string {
+	for i, o := range sortOrders {
+		if o == order {
+			return sortOrders[(i+1)%len(sortOrders)]
+		}
+	}
+	return sortRelevance
+}
+
+// frecencyWeight returns weight of a single run based on its age
+//		recent runs count more than old ones (similar to firefox frecency)
+func frecencyWeight(now, realtimeBefore float64) float64 {
+	age := now - realtimeBefore
+	hour := 60.0 * 60
+	day := 24 * hour
+	switch {
+	case age < 4*hour:
+		return 100
+	case age < day:
+		return 70
+	case age < 7*day:
+		return 50
+	case age < 30*day:
+		return 30
+	case age < 90*day:
+		return 10
+	}
+	return 5
+}
+
+// sortItems returns a sorted copy of items
+//		relevance is used to break ties in other orders
+func sortItems(data []item, order string) []item {
+	sorted := make([]item, len(data))
+	copy(sorted, data)
+	sort.SliceStable(sorted, func(p, q int) bool {
+		a, b := sorted[p], sorted[q]
+		switch order {
+		case sortRecent:
+			if a.lastRun != b.lastRun {
+				return a.lastRun > b.lastRun
+			}
+		case sortFrequent:
+			if a.runCount != b.runCount {
+				return a.runCount > b.runCount
+			}
+		case sortFrecency:
+			if a.frecency != b.frecency {
+				return a.frecency > b.frecency
+			}
+		}
+		return a.hits > b.hits
+	})
+	return sorted
+}
+
+// formatRelativeTime formats timestamp as "3h ago"
+func formatRelativeTime(now time.Time, timestamp float64) string {
+	if timestamp == 0 {
+		return "?"
+	}
+	age := now.Sub(time.Unix(int64(timestamp), 0))
+	if age < 0 {
+		age = 0
+	}
+	units := []struct {
+		suffix   string
+		duration time.Duration
+	}{
+		{"y", 365 * 24 * time.Hour},
+		{"mo", 30 * 24 * time.Hour},
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+	}
+	for _, unit := range units {
+		if age >= unit.duration {
+			return strconv.Itoa(int(age/unit.duration)) + unit.suffix + " ago"
+		}
+	}
+	return "now"
+}
+
+// timeColumn shows when the item was last run and how many times it was run
+func timeColumn(itm item, now time.Time) string {
+	runs := strconv.Itoa(itm.runCount) + "x"
+	return leftCutPadString(formatRelativeTime(now, itm.lastRun), 8) + " " + leftCutPadString(runs, 5) + " "
+}
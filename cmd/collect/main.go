@@ -23,6 +23,9 @@ var version string
 // Commit hash from git set during build
 var commit string
 
+// special exit code recognized by RESH widgets - recalled command comes from another session
+const exitCodeRecallShared = 5
+
 func main() {
 	usr, _ := user.Current()
 	dir := usr.HomeDir
@@ -80,11 +83,11 @@ func main() {
 	hosttype := flag.String("hosttype", "", "$HOSTTYPE")
 	ostype := flag.String("ostype", "", "$OSTYPE")
 	machtype := flag.String("machtype", "", "$MACHTYPE")
-	gitCdup := flag.String("gitCdup", "", "git rev-parse --show-cdup")
-	gitRemote := flag.String("gitRemote", "", "git remote get-url origin")
-
-	gitCdupExitCode := flag.Int("gitCdupExitCode", -1, "... $?")
-	gitRemoteExitCode := flag.Int("gitRemoteExitCode", -1, "... $?")
+	// deprecated - git info is read directly from .git (kept for sessions with older hooks)
+	flag.String("gitCdup", "", "deprecated")
+	flag.String("gitRemote", "", "deprecated")
+	flag.Int("gitCdupExitCode", -1, "deprecated")
+	flag.Int("gitRemoteExitCode", -1, "deprecated")
 
 	// before after
 	timezoneBefore := flag.String("timezoneBefore", "", "")
@@ -102,8 +105,14 @@ func main() {
 		"on session start $EPOCHREALTIME")
 	rtsessboot := flag.String("realtimeSessSinceBoot", "-1",
 		"on session start $EPOCHREALTIME")
+	input := flag.String("input", collect.InputFlags,
+		"also read values from 'json' object on stdin or from 'env' variables (e.g. RESH_CMD_LINE) - options take precedence")
 	flag.Parse()
 
+	if err := collect.ReadInput(flag.CommandLine, *input, os.Stdin, os.Environ()); err != nil {
+		log.Fatal("Input error: ", err)
+	}
+
 	if *showVersion == true {
 		fmt.Println(version)
 		os.Exit(0)
@@ -155,10 +164,7 @@ func main() {
 		realPwd = ""
 	}
 
-	gitDir, gitRealDir := collect.GetGitDirs(*gitCdup, *gitCdupExitCode, *pwd)
-	if *gitRemoteExitCode != 0 {
-		*gitRemote = ""
-	}
+	git, inGit := collect.ReadGitInfo(*pwd)
 
 	// if *osReleaseID == "" {
 	// 	*osReleaseID = "linux"
@@ -175,13 +181,28 @@ func main() {
 			SessionID:    *sessionID,
 			RecallHistno: *recallHistno,
 			RecallPrefix: *recallPrefix,
+			Shell:        *shell,
+			SessionPID:   *sessionPid,
 		}
-		str, found := collect.SendRecallRequest(rec, strconv.Itoa(config.Port))
-		if found == false {
+		resp := collect.SendRecallRequest(rec, strconv.Itoa(config.Port))
+		if resp.Found == false {
 			os.Exit(1)
 		}
-		fmt.Println(str)
+		fmt.Println(resp.CmdLine)
+		if resp.Shared {
+			os.Exit(exitCodeRecallShared)
+		}
 	} else {
+		collectors, err := collect.NewCollectors(config.Collectors, config.CollectEnv)
+		if err != nil {
+			log.Println("Collectors config error:", err)
+		}
+		if config.GitDirty && inGit {
+			git.Dirty, err = collect.IsGitDirty(git.Dir)
+			if err != nil {
+				log.Println("err while running git status:", err)
+			}
+		}
 		rec := records.Record{
 			// posix
 			Cols:  *cols,
@@ -225,17 +246,24 @@ func main() {
 				RealtimeSinceSessionStart: realtimeSinceSessionStart,
 				RealtimeSinceBoot:         realtimeSinceBoot,
 
-				GitDir:          gitDir,
-				GitRealDir:      gitRealDir,
-				GitOriginRemote: *gitRemote,
+				GitDir:          git.Dir,
+				GitRealDir:      git.RealDir,
+				GitOriginRemote: git.OriginRemote(),
 				MachineID:       collect.ReadFileContent(machineIDPath),
 
+				GitBranch:  git.Branch,
+				GitCommit:  git.Commit,
+				GitDirty:   git.Dirty,
+				GitRemotes: git.Remotes,
+
 				OsReleaseID:         *osReleaseID,
 				OsReleaseVersionID:  *osReleaseVersionID,
 				OsReleaseIDLike:     *osReleaseIDLike,
 				OsReleaseName:       *osReleaseName,
 				OsReleasePrettyName: *osReleasePrettyName,
 
+				Extra: collect.CollectExtra(collectors, os.Environ()),
+
 				PartOne: true,
 
 				ReshUUID:     collect.ReadFileContent(reshUUIDPath),
@@ -38,6 +38,8 @@ func main() {
 		printBoolNormalized(config.BindArrowKeysBash)
 	case "bindarrowkeyszsh":
 		printBoolNormalized(config.BindArrowKeysZsh)
+	case "bindarrowkeysfish":
+		printBoolNormalized(config.BindArrowKeysFish)
 	case "bindcontrolr":
 		printBoolNormalized(config.BindControlR)
 	default:
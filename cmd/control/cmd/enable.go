@@ -1,14 +1,23 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/curusarn/resh/cmd/control/status"
 	"github.com/curusarn/resh/pkg/cfg"
+	"github.com/curusarn/resh/pkg/msg"
+	"github.com/curusarn/resh/pkg/sesshist"
 	"github.com/spf13/cobra"
 )
 
@@ -54,6 +63,34 @@ var enableControlRBindingGlobalCmd = &cobra.Command{
 	},
 }
 
+var enableShareHistoryCmd = &cobra.Command{
+	Use:       "share_history [immediate|prompt]",
+	Short:     "enable sharing of history between concurrent sessions FOR THIS SHELL SESSION",
+	Long:      shareHistoryLong,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{sesshist.ShareImmediate, sesshist.SharePrompt},
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode = setShareHistory(getShareModeArg(args), false)
+	},
+}
+
+var enableShareHistoryGlobalCmd = &cobra.Command{
+	Use:       "share_history_global [immediate|prompt]",
+	Short:     "enable sharing of history between concurrent sessions FOR FUTURE SHELL SESSIONS",
+	Long:      shareHistoryLong,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{sesshist.ShareImmediate, sesshist.SharePrompt},
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode = setShareHistory(getShareModeArg(args), true)
+	},
+}
+
+const shareHistoryLong = "Commands from other running sessions are added to the recall list (arrow keys) of the session.\n" +
+	"Commands from the session itself are still recalled first.\n" +
+	"Modes:\n" +
+	" * prompt - commands from other sessions are added at the next prompt (default)\n" +
+	" * immediate - commands from other sessions are added right away"
+
 // Disable commands
 
 var disableCmd = &cobra.Command{
@@ -96,6 +133,101 @@ var disableControlRBindingGlobalCmd = &cobra.Command{
 	},
 }
 
+var disableShareHistoryCmd = &cobra.Command{
+	Use:   "share_history",
+	Short: "disable sharing of history between concurrent sessions FOR THIS SHELL SESSION",
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode = setShareHistory(sesshist.ShareOff, false)
+	},
+}
+
+var disableShareHistoryGlobalCmd = &cobra.Command{
+	Use:   "share_history_global",
+	Short: "disable sharing of history between concurrent sessions FOR FUTURE SHELL SESSIONS",
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode = setShareHistory(sesshist.ShareOff, true)
+	},
+}
+
+func getShareModeArg(args []string) string {
+	if len(args) == 0 {
+		return sesshist.SharePrompt
+	}
+	return args[0]
+}
+
+func setShareHistory(mode string, global bool) status.Code {
+	if sesshist.IsValidShareMode(mode) == false {
+		fmt.Println("Error: Unknown share history mode:", mode)
+		return status.Fail
+	}
+	if global == false {
+		sessionID, found := os.LookupEnv("__RESH_SESSION_ID")
+		if found == false || sessionID == "" {
+			fmt.Println("Error while determining the session you are using - your RESH instalation is probably broken. Please reinstall RESH - exiting!")
+			return status.Fail
+		}
+		err := sendShareHistoryMsg(msg.ShareHistoryMsg{SessionID: sessionID, Mode: mode}, config.Port)
+		if err != nil {
+			fmt.Println("Error: Failed to set share history mode for this session:", err)
+			return status.Fail
+		}
+		fmt.Println("Share history mode for THIS SHELL SESSION set to: " + mode)
+		return status.Success
+	}
+
+	usr, _ := user.Current()
+	dir := usr.HomeDir
+	configPath := filepath.Join(dir, ".config/resh.toml")
+	var config cfg.Config
+	if _, err := toml.DecodeFile(configPath, &config); err != nil {
+		fmt.Println("Error reading config", err)
+		return status.Fail
+	}
+	if config.SesshistShareHistory == mode {
+		fmt.Println("Share history mode is ALREADY GLOBALLY set to: " + mode + " - nothing to do - exiting.")
+		return status.Success
+	}
+	config.SesshistShareHistory = mode
+
+	f, err := os.Create(configPath)
+	if err != nil {
+		fmt.Println("Error: Failed to create/open file:", configPath, "; error:", err)
+		return status.Fail
+	}
+	defer f.Close()
+	if err := toml.NewEncoder(f).Encode(config); err != nil {
+		fmt.Println("Error: Failed to encode and write the config values to hdd. error:", err)
+		return status.Fail
+	}
+	// running daemon should use the new mode for new sessions without restart
+	err = sendShareHistoryMsg(msg.ShareHistoryMsg{Mode: mode}, config.Port)
+	if err != nil {
+		fmt.Println("Warn: Failed to notify the daemon - new mode will be used after daemon restart:", err)
+	}
+	fmt.Println("SUCCESSFULLY set share history mode GLOBALLY to: " + mode +
+		" - every new shell session will start with this mode!")
+	return status.Success
+}
+
+func sendShareHistoryMsg(m msg.ShareHistoryMsg, port int) error {
+	jsn, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	url := "http://localhost:" + strconv.Itoa(port) + "/share_history"
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsn))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
 func enableDisableArrowKeyBindingsGlobally(value bool) status.Code {
 	usr, _ := user.Current()
 	dir := usr.HomeDir
@@ -106,8 +238,8 @@ func enableDisableArrowKeyBindingsGlobally(value bool) status.Code {
 		return status.Fail
 	}
 	shell, found := os.LookupEnv("__RESH_ctl_shell")
-	// shell env variable must be set and must be equal to either bash or zsh
-	if found == false || (shell != "bash" && shell != "zsh") {
+	// shell env variable must be set and must be equal to either bash, zsh or fish
+	if found == false || (shell != "bash" && shell != "zsh" && shell != "fish") {
 		fmt.Println("Error while determining a shell you are using - your RESH instalation is probably broken. Please reinstall RESH - exiting!")
 		fmt.Println("found=", found, "shell=", shell)
 		return status.Fail
@@ -122,6 +254,11 @@ func enableDisableArrowKeyBindingsGlobally(value bool) status.Code {
 		if err != nil {
 			return status.Fail
 		}
+	} else if shell == "fish" {
+		err := setConfigBindArrowKey(configPath, &config, &config.BindArrowKeysFish, shell, value)
+		if err != nil {
+			return status.Fail
+		}
 	} else {
 		fmt.Println("FATAL ERROR while determining a shell you are using - your RESH instalation is probably broken. Please reinstall RESH - exiting!")
 	}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"sort"
+
+	"github.com/curusarn/resh/cmd/control/status"
+	"github.com/curusarn/resh/pkg/queryhist"
+	"github.com/spf13/cobra"
+)
+
+var queriesStats bool
+
+var queriesCmd = &cobra.Command{
+	Use:   "queries",
+	Short: "show history of RESH CLI searches",
+	Long: "Prints history of RESH CLI searches as JSON lines (query, picked command, its rank, ...).\n" +
+		"Use --stats to show how well RESH CLI ranks the picked commands.",
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode = status.Fail
+		usr, _ := user.Current()
+		dir := usr.HomeDir
+		path := filepath.Join(dir, ".resh/cli-queries.json")
+		entries, err := queryhist.Load(path)
+		if err != nil {
+			fmt.Println("Error reading query history:", err)
+			return
+		}
+		if queriesStats == false {
+			for _, entry := range entries {
+				jsn, err := json.Marshal(entry)
+				if err != nil {
+					fmt.Println("Error encoding query history:", err)
+					return
+				}
+				fmt.Println(string(jsn))
+			}
+			exitCode = status.Success
+			return
+		}
+		stats := queryhist.ComputeStats(entries)
+		fmt.Println("Searches:            ", stats.Searches)
+		fmt.Println("Picked:              ", stats.Picked)
+		fmt.Println("Aborted:             ", stats.Aborted)
+		if stats.Picked > 0 {
+			percent := func(n int) string {
+				return fmt.Sprintf("%d (%.1f%%)", n, 100*float64(n)/float64(stats.Picked))
+			}
+			fmt.Printf("Mean reciprocal rank: %.3f\n", stats.MeanReciprocalRank)
+			fmt.Println("Picked 1st:          ", percent(stats.Top1))
+			fmt.Println("Picked in top 3:     ", percent(stats.Top3))
+			fmt.Println("Picked in top 10:    ", percent(stats.Top10))
+			fmt.Println()
+			fmt.Println("Rank  Picked")
+			var ranks []int
+			for rank := range stats.RankCounts {
+				ranks = append(ranks, rank)
+			}
+			sort.Ints(ranks)
+			for _, rank := range ranks {
+				fmt.Printf("%4d  %d\n", rank+1, stats.RankCounts[rank])
+			}
+		}
+		exitCode = status.Success
+	},
+}
+
+func init() {
+	queriesCmd.Flags().BoolVar(&queriesStats, "stats", false, "show ranking statistics")
+}
@@ -46,12 +46,16 @@ func Execute(ver, com string) status.Code {
 	enableCmd.AddCommand(enableArrowKeyBindingsGlobalCmd)
 	enableCmd.AddCommand(enableControlRBindingCmd)
 	enableCmd.AddCommand(enableControlRBindingGlobalCmd)
+	enableCmd.AddCommand(enableShareHistoryCmd)
+	enableCmd.AddCommand(enableShareHistoryGlobalCmd)
 
 	rootCmd.AddCommand(disableCmd)
 	disableCmd.AddCommand(disableArrowKeyBindingsCmd)
 	disableCmd.AddCommand(disableArrowKeyBindingsGlobalCmd)
 	disableCmd.AddCommand(disableControlRBindingCmd)
 	disableCmd.AddCommand(disableControlRBindingGlobalCmd)
+	disableCmd.AddCommand(disableShareHistoryCmd)
+	disableCmd.AddCommand(disableShareHistoryGlobalCmd)
 
 	rootCmd.AddCommand(completionCmd)
 	completionCmd.AddCommand(completionBashCmd)
@@ -68,6 +72,12 @@ func Execute(ver, com string) status.Code {
 
 	rootCmd.AddCommand(sanitizeCmd)
 
+	rootCmd.AddCommand(queriesCmd)
+
+	rootCmd.AddCommand(sessionsCmd)
+
+	rootCmd.AddCommand(scrubCmd)
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		return status.Fail
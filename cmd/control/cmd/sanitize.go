@@ -20,7 +20,8 @@ var sanitizeCmd = &cobra.Command{
 
 		fmt.Println()
 		fmt.Println(" HOW IT WORKS")
-		fmt.Println("   In sanitized history, all sensitive information is replaced with its SHA1 hashes.")
+		fmt.Println("   In sanitized history, all sensitive information is replaced with its keyed hashes (HMAC-SHA256).")
+		fmt.Println("   The secret key is saved in ~/.resh/sanitizer-key - keep it private.")
 		fmt.Println()
 		fmt.Println("Sanitizing ...")
 		fmt.Println(" * ~/resh_history_sanitized.json (full lengh hashes)")
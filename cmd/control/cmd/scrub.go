@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curusarn/resh/cmd/control/status"
+	"github.com/curusarn/resh/pkg/msg"
+	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/scrubber"
+	"github.com/spf13/cobra"
+)
+
+var scrubCheck bool
+
+var scrubCmd = &cobra.Command{
+	Use:   "scrub",
+	Short: "scrub secrets from your RESH history",
+	Long: "Redacts secrets (API keys, tokens, passwords, ...) in ~/.resh_history.json or drops records containing them - see [scrub] in ~/.config/resh.toml.\n" +
+		"Use --check to only list records with secrets without changing the history.",
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode = status.Fail
+		if scrubCheck {
+			usr, _ := user.Current()
+			dir := usr.HomeDir
+			historyPath := filepath.Join(dir, ".resh_history.json")
+			err := checkSecrets(historyPath)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			exitCode = status.Success
+			return
+		}
+		resp, err := sendScrubMsg(config.Port)
+		if err != nil {
+			fmt.Println("Error scrubbing history:", err)
+			return
+		}
+		fmt.Println("Redacted records:", resp.Redacted)
+		fmt.Println("Dropped records: ", resp.Dropped)
+		exitCode = status.Success
+	},
+}
+
+func init() {
+	scrubCmd.Flags().BoolVar(&scrubCheck, "check", false, "only list records with secrets (don't change the history)")
+}
+
+// checkSecrets prints records with secrets (with secrets redacted) and a summary
+func checkSecrets(historyPath string) error {
+	scrub, err := scrubber.New(config.Scrub)
+	if err != nil {
+		return err
+	}
+	total, found := 0, 0
+	for _, rec := range records.LoadFromFile(historyPath, math.MaxInt32) {
+		if rec.SessionExit {
+			continue
+		}
+		total++
+		cmdLine, detected := scrub.ScrubCmdLine(rec.CmdLine)
+		_, detectedRecall := scrub.ScrubCmdLine(rec.RecallLastCmdLine)
+		if len(detected) == 0 && len(detectedRecall) == 0 {
+			continue
+		}
+		found++
+		tm := time.Unix(int64(rec.RealtimeBefore), 0).Format("2006-01-02 15:04:05")
+		fmt.Println(tm + "  [" + strings.Join(append(detected, detectedRecall...), ",") + "]  " + cmdLine)
+	}
+	fmt.Println()
+	fmt.Println("Records with secrets:", found, "of", total)
+	if found > 0 {
+		fmt.Println("Run 'reshctl scrub' to " + scrub.Action() + " them.")
+	}
+	return nil
+}
+
+func sendScrubMsg(port int) (msg.ScrubResponse, error) {
+	var resp msg.ScrubResponse
+	url := "http://localhost:" + strconv.Itoa(port) + "/scrub"
+	httpResp, err := http.Post(url, "application/json", bytes.NewBufferString("{}"))
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return resp, errors.New(strings.TrimSpace(string(body)))
+	}
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
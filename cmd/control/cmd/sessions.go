@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curusarn/resh/cmd/control/status"
+	"github.com/curusarn/resh/pkg/msg"
+	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/sesstree"
+	"github.com/spf13/cobra"
+)
+
+var sessionsCurrent bool
+var sessionsJSON bool
+
+// sessionJSON is a session with summary (if the session has ended) printed by --json
+type sessionJSON struct {
+	sesstree.Session
+	Summary *records.SessionSummary `json:"summary,omitempty"`
+}
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "show tree of shell sessions",
+	Long: "Prints shell sessions as a tree - nested shells and shells started from tmux are children of the session they were started from.\n" +
+		"Sessions that have ended are shown with a summary (end time, number of commands and failures, directories visited, time spent in commands).\n" +
+		"Use --current to only show the current session and its descendants.",
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode = status.Fail
+		mess := msg.SessionsMsg{}
+		if sessionsCurrent {
+			mess.SessionID = os.Getenv("__RESH_SESSION_ID")
+			if mess.SessionID == "" {
+				fmt.Println("Error: current session is unknown - is RESH loaded in this shell?")
+				return
+			}
+		}
+		resp, err := sendSessionsMsg(mess, config.Port)
+		if err != nil {
+			fmt.Println("Error getting sessions from the daemon:", err)
+			return
+		}
+		if sessionsJSON {
+			for _, session := range resp.Sessions {
+				out := sessionJSON{Session: session}
+				if summary, found := resp.Summaries[session.ID]; found {
+					out.Summary = &summary
+				}
+				jsn, err := json.Marshal(out)
+				if err != nil {
+					fmt.Println("Error encoding session:", err)
+					return
+				}
+				fmt.Println(string(jsn))
+			}
+			exitCode = status.Success
+			return
+		}
+		printSessionTree(resp.Sessions, resp.Summaries)
+		exitCode = status.Success
+	},
+}
+
+func init() {
+	sessionsCmd.Flags().BoolVar(&sessionsCurrent, "current", false, "only show the current session and its descendants")
+	sessionsCmd.Flags().BoolVar(&sessionsJSON, "json", false, "print sessions as JSON lines")
+}
+
+func sendSessionsMsg(m msg.SessionsMsg, port int) (msg.SessionsResponse, error) {
+	var resp msg.SessionsResponse
+	jsn, err := json.Marshal(m)
+	if err != nil {
+		return resp, err
+	}
+	url := "http://localhost:" + strconv.Itoa(port) + "/sessions"
+	httpResp, err := http.Post(url, "application/json", bytes.NewBuffer(jsn))
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return resp, errors.New(strings.TrimSpace(string(body)))
+	}
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
+
+// printSessionTree prints sessions (sorted by start time) with children indented under their parents
+func printSessionTree(sessions []sesstree.Session, summaries map[string]records.SessionSummary) {
+	known := map[string]bool{}
+	for _, session := range sessions {
+		known[session.ID] = true
+	}
+	children := map[string][]sesstree.Session{}
+	var roots []sesstree.Session
+	for _, session := range sessions {
+		if session.ParentID == "" || known[session.ParentID] == false {
+			roots = append(roots, session)
+			continue
+		}
+		children[session.ParentID] = append(children[session.ParentID], session)
+	}
+	var printNode func(session sesstree.Session, depth int)
+	printNode = func(session sesstree.Session, depth int) {
+		line := strings.Repeat("  ", depth) + formatSession(session)
+		if summary, found := summaries[session.ID]; found {
+			line += "  " + formatSummary(summary)
+		}
+		fmt.Println(line)
+		for _, child := range children[session.ID] {
+			printNode(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		printNode(root, 0)
+	}
+}
+
+func formatSession(session sesstree.Session) string {
+	start := time.Unix(int64(session.RealtimeStart), 0).Format("2006-01-02 15:04:05")
+	parts := []string{start, session.ID, session.Shell + "@" + session.Host}
+	if session.TmuxPane != "" {
+		parts = append(parts, "tmux:"+session.TmuxSession+session.TmuxWindow+session.TmuxPane)
+	}
+	if session.SSHClient != "" {
+		parts = append(parts, "ssh:"+session.SSHClient)
+	}
+	return strings.Join(parts, "  ")
+}
+
+func formatSummary(summary records.SessionSummary) string {
+	end := time.Unix(int64(summary.RealtimeEnd), 0).Format("2006-01-02 15:04:05")
+	commandsDuration := time.Duration(summary.CommandsDuration * float64(time.Second)).Round(time.Second)
+	return fmt.Sprintf("[ended %s, %d commands (%d failed), %d dirs, %s in commands]",
+		end, summary.CommandCount, summary.FailedCount, len(summary.Dirs), commandsDuration)
+}
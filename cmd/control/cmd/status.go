@@ -43,6 +43,14 @@ var statusCmd = &cobra.Command{
 			fmt.Println(" * Please RESTART this terminal window")
 		}
 
+		fmt.Println()
+		fmt.Println("Share history ...")
+		shareMode := config.SesshistShareHistory
+		if shareMode == "" {
+			shareMode = "off"
+		}
+		fmt.Println(" * future sessions: " + shareMode)
+
 		fmt.Println()
 		fmt.Println("Arrow key bindings ...")
 		if config.BindArrowKeysBash {
@@ -55,6 +63,11 @@ var statusCmd = &cobra.Command{
 		} else {
 			fmt.Println(" * zsh future sessions: DISABLED (not recommended)")
 		}
+		if config.BindArrowKeysFish {
+			fmt.Println(" * fish future sessions: ENABLED (recommended)")
+		} else {
+			fmt.Println(" * fish future sessions: DISABLED (not recommended)")
+		}
 
 		exitCode = status.ReshStatus
 	},
@@ -8,10 +8,13 @@ import (
 
 	"github.com/curusarn/resh/pkg/histfile"
 	"github.com/curusarn/resh/pkg/msg"
+	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/tags"
 )
 
 type dumpHandler struct {
 	histfileBox *histfile.Histfile
+	tags        *tags.Tags
 }
 
 func (h *dumpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +46,13 @@ func (h *dumpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Println("Dump error:", err)
 	}
 
-	resp := msg.DumpResponse{FullRecords: fullRecords.List}
+	// copy records so the tags don't end up in the shared list
+	recs := make([]records.EnrichedRecord, len(fullRecords.List))
+	for i, rec := range fullRecords.List {
+		rec.Tags = h.tags.Get(rec.CmdLine)
+		recs[i] = rec
+	}
+	resp := msg.DumpResponse{FullRecords: recs}
 	jsn, err = json.Marshal(&resp)
 	if err != nil {
 		log.Println("Encoding error:", err)
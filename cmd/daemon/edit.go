@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/curusarn/resh/pkg/histfile"
+	"github.com/curusarn/resh/pkg/msg"
+	"github.com/curusarn/resh/pkg/scrubber"
+	"github.com/curusarn/resh/pkg/sesshist"
+	"github.com/curusarn/resh/pkg/tags"
+)
+
+type deleteHandler struct {
+	histfileBox      *histfile.Histfile
+	sesshistDispatch *sesshist.Dispatch
+	tags             *tags.Tags
+}
+
+func (h *deleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Println("/delete START")
+	jsn, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Error reading the body", err)
+		return
+	}
+
+	mess := msg.DeleteMsg{}
+	err = json.Unmarshal(jsn, &mess)
+	if err != nil {
+		log.Println("Decoding error:", err)
+		log.Println("Payload:", jsn)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := map[msg.ItemRef]bool{}
+	for _, item := range mess.Items {
+		items[item] = true
+	}
+	deleted, removedCmdLines, err := h.histfileBox.DeleteRecords(func(cmdLine, pwd string) bool {
+		return items[msg.ItemRef{CmdLine: cmdLine, Pwd: pwd}]
+	})
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(removedCmdLines) > 0 {
+		h.sesshistDispatch.RemoveCmdLines(removedCmdLines)
+		h.tags.RemoveCmdLines(removedCmdLines)
+	}
+
+	jsn, err = json.Marshal(&msg.DeleteResponse{Deleted: deleted})
+	if err != nil {
+		log.Println("Encoding error:", err)
+		return
+	}
+	w.Write(jsn)
+	log.Println("/delete END - items:", len(mess.Items), " - deleted records:", deleted)
+}
+
+type scrubHandler struct {
+	histfileBox      *histfile.Histfile
+	sesshistDispatch *sesshist.Dispatch
+	tags             *tags.Tags
+	// nil if scrub config is invalid
+	scrubber *scrubber.Scrubber
+}
+
+func (h *scrubHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Println("/scrub START")
+	if h.scrubber == nil {
+		http.Error(w, "invalid scrub config - see daemon log", http.StatusInternalServerError)
+		return
+	}
+	redacted, dropped, removedCmdLines, err := h.histfileBox.ScrubRecords(h.scrubber.Scrub)
+	if err != nil {
+		log.Println("Scrub error:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(removedCmdLines) > 0 {
+		h.sesshistDispatch.RemoveCmdLines(removedCmdLines)
+		h.tags.RemoveCmdLines(removedCmdLines)
+	}
+
+	jsn, err := json.Marshal(&msg.ScrubResponse{Redacted: redacted, Dropped: dropped})
+	if err != nil {
+		log.Println("Encoding error:", err)
+		return
+	}
+	w.Write(jsn)
+	log.Println("/scrub END - redacted records:", redacted, " - dropped records:", dropped)
+}
+
+type tagHandler struct {
+	tags *tags.Tags
+}
+
+func (h *tagHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Println("/tag START")
+	jsn, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Error reading the body", err)
+		return
+	}
+
+	mess := msg.TagMsg{}
+	err = json.Unmarshal(jsn, &mess)
+	if err != nil {
+		log.Println("Decoding error:", err)
+		log.Println("Payload:", jsn)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if mess.Tag == "" {
+		http.Error(w, "empty tag", http.StatusBadRequest)
+		return
+	}
+	if mess.Remove {
+		err = h.tags.Remove(mess.CmdLines, mess.Tag)
+	} else {
+		err = h.tags.Add(mess.CmdLines, mess.Tag)
+	}
+	if err != nil {
+		log.Println("Tag error:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("OK\n"))
+	log.Println("/tag END - tag:", mess.Tag, " - remove:", mess.Remove, " - cmdLines:", len(mess.CmdLines))
+}
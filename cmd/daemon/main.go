@@ -39,6 +39,14 @@ func main() {
 	reshHistoryPath := filepath.Join(dir, ".resh_history.json")
 	bashHistoryPath := filepath.Join(dir, ".bash_history")
 	zshHistoryPath := filepath.Join(dir, ".zsh_history")
+	fishDataDir := filepath.Join(dir, ".local/share")
+	if xdgDataHome := os.Getenv("XDG_DATA_HOME"); xdgDataHome != "" {
+		fishDataDir = xdgDataHome
+	}
+	fishHistoryPath := filepath.Join(fishDataDir, "fish/fish_history")
+	sesshistStatePath := filepath.Join(dir, ".resh/sesshist.json")
+	tagsPath := filepath.Join(dir, ".resh/tags.json")
+	sessionsPath := filepath.Join(dir, ".resh/sessions.json")
 	logPath := filepath.Join(dir, ".resh/daemon.log")
 
 	f, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
@@ -81,7 +89,7 @@ func main() {
 	if err != nil {
 		log.Fatal("Could not create pidfile", err)
 	}
-	runServer(config, reshHistoryPath, bashHistoryPath, zshHistoryPath)
+	runServer(config, reshHistoryPath, bashHistoryPath, zshHistoryPath, fishHistoryPath, sesshistStatePath, tagsPath, sessionsPath)
 	log.Println("main: Removing pidfile ...")
 	err = os.Remove(pidfilePath)
 	if err != nil {
@@ -41,14 +41,15 @@ func (h *recallHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Println("/recall recalling ...")
 	}
 	found := true
-	cmd, err := h.sesshistDispatch.Recall(rec.SessionID, rec.RecallHistno, rec.RecallPrefix)
+	cmd, shared, err := h.sesshistDispatch.Recall(rec.SessionID, rec.Shell, rec.SessionPID,
+		rec.RecallHistno, rec.RecallPrefix)
 	if err != nil {
 		log.Println("/recall - sess id:", rec.SessionID, " - histno:", rec.RecallHistno, " -> ERROR")
 		log.Println("Recall error:", err)
 		found = false
 		cmd = ""
 	}
-	resp := collect.SingleResponse{CmdLine: cmd, Found: found}
+	resp := collect.SingleResponse{CmdLine: cmd, Found: found, Shared: shared}
 	if Debug {
 		log.Println("/recall marshaling response ...")
 	}
@@ -63,7 +64,7 @@ func (h *recallHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Println("/recall writing response ...")
 	}
 	w.Write(jsn)
-	log.Println("/recall END - sess id:", rec.SessionID, " - histno:", rec.RecallHistno, " -> ", cmd, " (found:", found, ")")
+	log.Println("/recall END - sess id:", rec.SessionID, " - histno:", rec.RecallHistno, " -> ", cmd, " (found:", found, ", shared:", shared, ")")
 }
 
 type inspectHandler struct {
@@ -107,3 +108,33 @@ func (h *inspectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsn)
 	log.Println("/inspect END - sess id:", mess.SessionID, " - count:", mess.Count)
 }
+
+type shareHistoryHandler struct {
+	sesshistDispatch *sesshist.Dispatch
+}
+
+func (h *shareHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Println("/share_history START")
+	jsn, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Error reading the body", err)
+		return
+	}
+
+	mess := msg.ShareHistoryMsg{}
+	err = json.Unmarshal(jsn, &mess)
+	if err != nil {
+		log.Println("Decoding error:", err)
+		log.Println("Payload:", jsn)
+		return
+	}
+	err = h.sesshistDispatch.SetShareMode(mess.SessionID, mess.Mode)
+	if err != nil {
+		log.Println("/share_history - sess id:", mess.SessionID, " - mode:", mess.Mode, " -> ERROR")
+		log.Println("Share history error:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte("OK\n"))
+	log.Println("/share_history END - sess id:", mess.SessionID, " - mode:", mess.Mode)
+}
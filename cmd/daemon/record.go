@@ -7,10 +7,15 @@ import (
 	"net/http"
 
 	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/scrubber"
+	"github.com/curusarn/resh/pkg/sesstree"
 )
 
 type recordHandler struct {
 	subscribers []chan records.Record
+	sessTree    *sesstree.Tree
+	// nil if scrubbing of secrets is disabled
+	scrubber *scrubber.Scrubber
 }
 
 func (h *recordHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -30,13 +35,18 @@ func (h *recordHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			log.Println("Payload: ", jsn)
 			return
 		}
-		for _, sub := range h.subscribers {
-			sub <- record
-		}
+		h.sessTree.Enrich(&record)
 		part := "2"
 		if record.PartOne {
 			part = "1"
 		}
+		if h.scrubber != nil && h.scrubber.Scrub(&record) == false {
+			log.Println("/record - dropped record with secrets - detectors:", record.ScrubDetectors, " - part", part)
+			return
+		}
+		for _, sub := range h.subscribers {
+			sub <- record
+		}
 		log.Println("/record - ", record.CmdLine, " - part", part)
 	}()
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -8,12 +9,15 @@ import (
 	"github.com/curusarn/resh/pkg/cfg"
 	"github.com/curusarn/resh/pkg/histfile"
 	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/scrubber"
 	"github.com/curusarn/resh/pkg/sesshist"
+	"github.com/curusarn/resh/pkg/sesstree"
 	"github.com/curusarn/resh/pkg/sesswatch"
 	"github.com/curusarn/resh/pkg/signalhandler"
+	"github.com/curusarn/resh/pkg/tags"
 )
 
-func runServer(config cfg.Config, reshHistoryPath, bashHistoryPath, zshHistoryPath string) {
+func runServer(config cfg.Config, reshHistoryPath, bashHistoryPath, zshHistoryPath, fishHistoryPath, sesshistStatePath, tagsPath, sessionsPath string) {
 	var recordSubscribers []chan records.Record
 	var sessionInitSubscribers []chan records.Record
 	var sessionDropSubscribers []chan string
@@ -28,6 +32,8 @@ func runServer(config cfg.Config, reshHistoryPath, bashHistoryPath, zshHistoryPa
 	sessionDropSubscribers = append(sessionDropSubscribers, sesshistSessionsToDrop)
 	sesshistRecords := make(chan records.Record)
 	recordSubscribers = append(recordSubscribers, sesshistRecords)
+	sesshistSignals := make(chan os.Signal)
+	signalSubscribers = append(signalSubscribers, sesshistSignals)
 
 	// histfile
 	histfileRecords := make(chan records.Record)
@@ -39,14 +45,16 @@ func runServer(config cfg.Config, reshHistoryPath, bashHistoryPath, zshHistoryPa
 	maxHistSize := 10000  // lines
 	minHistSizeKB := 2000 // roughly lines
 	histfileBox := histfile.New(histfileRecords, histfileSessionsToDrop,
-		reshHistoryPath, bashHistoryPath, zshHistoryPath,
+		reshHistoryPath, bashHistoryPath, zshHistoryPath, fishHistoryPath,
 		maxHistSize, minHistSizeKB,
 		histfileSignals, shutdown)
 
 	// sesshist New
 	sesshistDispatch := sesshist.NewDispatch(sesshistSessionsToInit, sesshistSessionsToDrop,
 		sesshistRecords, histfileBox,
-		config.SesshistInitHistorySize)
+		config.SesshistInitHistorySize, config.SesshistShareHistory,
+		sesshistStatePath, config.SesshistPersistPeriodSeconds,
+		sesshistSignals, shutdown)
 
 	// sesswatch
 	sesswatchRecords := make(chan records.Record)
@@ -54,15 +62,46 @@ func runServer(config cfg.Config, reshHistoryPath, bashHistoryPath, zshHistoryPa
 	sesswatchSessionsToWatch := make(chan records.Record)
 	sessionInitSubscribers = append(sessionInitSubscribers, sesswatchRecords, sesswatchSessionsToWatch)
 	sesswatch.Go(sesswatchSessionsToWatch, sesswatchRecords, sessionDropSubscribers, config.SesswatchPeriodSeconds)
+	// watch sessions restored from previous run of the daemon
+	go func() {
+		for _, session := range sesshistDispatch.Sessions() {
+			sesswatchSessionsToWatch <- records.Record{
+				BaseRecord: records.BaseRecord{SessionID: session.ID, SessionPID: session.PID},
+			}
+		}
+	}()
+
+	// session tree (parent/child sessions, tmux, SSH)
+	sesstreeSessionsToInit := make(chan records.Record)
+	sessionInitSubscribers = append(sessionInitSubscribers, sesstreeSessionsToInit)
+	sessTree := sesstree.New(sessionsPath, sesstreeSessionsToInit)
+
+	// user defined tags (e.g. favourite commands)
+	cmdTags := tags.New(tagsPath)
+
+	// secret scrubbing
+	scrub, err := scrubber.New(config.Scrub)
+	if err != nil {
+		log.Println("Error in scrub config - secrets won't be scrubbed:", err)
+	}
+	var recordScrubber *scrubber.Scrubber
+	if config.Scrub.Enabled {
+		recordScrubber = scrub
+	}
 
 	// handlers
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status", statusHandler)
-	mux.Handle("/record", &recordHandler{subscribers: recordSubscribers})
+	mux.Handle("/record", &recordHandler{subscribers: recordSubscribers, sessTree: sessTree, scrubber: recordScrubber})
 	mux.Handle("/session_init", &sessionInitHandler{subscribers: sessionInitSubscribers})
 	mux.Handle("/recall", &recallHandler{sesshistDispatch: sesshistDispatch})
 	mux.Handle("/inspect", &inspectHandler{sesshistDispatch: sesshistDispatch})
-	mux.Handle("/dump", &dumpHandler{histfileBox: histfileBox})
+	mux.Handle("/share_history", &shareHistoryHandler{sesshistDispatch: sesshistDispatch})
+	mux.Handle("/dump", &dumpHandler{histfileBox: histfileBox, tags: cmdTags})
+	mux.Handle("/delete", &deleteHandler{histfileBox: histfileBox, sesshistDispatch: sesshistDispatch, tags: cmdTags})
+	mux.Handle("/tag", &tagHandler{tags: cmdTags})
+	mux.Handle("/scrub", &scrubHandler{histfileBox: histfileBox, sesshistDispatch: sesshistDispatch, tags: cmdTags, scrubber: scrub})
+	mux.Handle("/sessions", &sessionsHandler{sessTree: sessTree, histfileBox: histfileBox})
 
 	server := &http.Server{Addr: ":" + strconv.Itoa(config.Port), Handler: mux}
 	go server.ListenAndServe()
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/curusarn/resh/pkg/histfile"
+	"github.com/curusarn/resh/pkg/msg"
+	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/sesstree"
+)
+
+type sessionsHandler struct {
+	sessTree    *sesstree.Tree
+	histfileBox *histfile.Histfile
+}
+
+func (h *sessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Println("/sessions START")
+	jsn, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Error reading the body", err)
+		return
+	}
+
+	mess := msg.SessionsMsg{}
+	err = json.Unmarshal(jsn, &mess)
+	if err != nil {
+		log.Println("Decoding error:", err)
+		log.Println("Payload:", jsn)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sessionExits := h.histfileBox.SessionExits()
+	var sessions []sesstree.Session
+	if mess.SessionID == "" {
+		sessions = h.sessTree.Sessions()
+		sessions = addEndedSessions(sessions, sessionExits)
+	} else {
+		sessions = h.sessTree.Subtree(mess.SessionID)
+	}
+	listed := map[string]bool{}
+	for _, session := range sessions {
+		listed[session.ID] = true
+	}
+	summaries := map[string]records.SessionSummary{}
+	for _, exit := range sessionExits {
+		if listed[exit.SessionID] && exit.SessionSummary != nil {
+			summaries[exit.SessionID] = *exit.SessionSummary
+		}
+	}
+
+	jsn, err = json.Marshal(&msg.SessionsResponse{Sessions: sessions, Summaries: summaries})
+	if err != nil {
+		log.Println("Encoding error:", err)
+		return
+	}
+	w.Write(jsn)
+	log.Println("/sessions END - sessions:", len(sessions))
+}
+
+// addEndedSessions adds sessions that are only known from their session exit records (e.g. from before the session tree existed)
+func addEndedSessions(sessions []sesstree.Session, sessionExits []records.Record) []sesstree.Session {
+	known := map[string]bool{}
+	for _, session := range sessions {
+		known[session.ID] = true
+	}
+	added := false
+	for _, exit := range sessionExits {
+		if known[exit.SessionID] || exit.SessionSummary == nil {
+			continue
+		}
+		session := sesstree.NewSession(exit)
+		session.RealtimeStart = exit.SessionSummary.RealtimeStart
+		sessions = append(sessions, session)
+		known[exit.SessionID] = true
+		added = true
+	}
+	if added {
+		sort.SliceStable(sessions, func(i, j int) bool {
+			return sessions[i].RealtimeStart < sessions[j].RealtimeStart
+		})
+	}
+	return sessions
+}
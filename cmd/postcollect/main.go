@@ -43,6 +43,7 @@ func main() {
 
 	cmdLine := flag.String("cmdLine", "", "command line")
 	exitCode := flag.Int("exitCode", -1, "exit code")
+	pipeStatus := flag.String("pipeStatus", "", "exit codes of pipeline commands (e.g. \"0 1\" - $PIPESTATUS/$pipestatus)")
 	sessionID := flag.String("sessionId", "", "resh generated session id")
 	shlvl := flag.Int("shlvl", -1, "$SHLVL")
 	shell := flag.String("shell", "", "actual shell")
@@ -53,19 +54,25 @@ func main() {
 	// non-posix
 	// sessionPid := flag.Int("sessionPid", -1, "$$ at session start")
 
-	gitCdupAfter := flag.String("gitCdupAfter", "", "git rev-parse --show-cdup")
-	gitRemoteAfter := flag.String("gitRemoteAfter", "", "git remote get-url origin")
-
-	gitCdupExitCodeAfter := flag.Int("gitCdupExitCodeAfter", -1, "... $?")
-	gitRemoteExitCodeAfter := flag.Int("gitRemoteExitCodeAfter", -1, "... $?")
+	// deprecated - git info is read directly from .git (kept for sessions with older hooks)
+	flag.String("gitCdupAfter", "", "deprecated")
+	flag.String("gitRemoteAfter", "", "deprecated")
+	flag.Int("gitCdupExitCodeAfter", -1, "deprecated")
+	flag.Int("gitRemoteExitCodeAfter", -1, "deprecated")
 
 	// before after
 	timezoneAfter := flag.String("timezoneAfter", "", "")
 
 	rtb := flag.String("realtimeBefore", "-1", "before $EPOCHREALTIME")
 	rta := flag.String("realtimeAfter", "-1", "after $EPOCHREALTIME")
+	input := flag.String("input", collect.InputFlags,
+		"also read values from 'json' object on stdin or from 'env' variables (e.g. RESH_CMD_LINE) - options take precedence")
 	flag.Parse()
 
+	if err := collect.ReadInput(flag.CommandLine, *input, os.Stdin, os.Environ()); err != nil {
+		log.Fatal("Input error: ", err)
+	}
+
 	if *showVersion == true {
 		fmt.Println(version)
 		os.Exit(0)
@@ -107,9 +114,11 @@ func main() {
 		realPwdAfter = ""
 	}
 
-	gitDirAfter, gitRealDirAfter := collect.GetGitDirs(*gitCdupAfter, *gitCdupExitCodeAfter, *pwdAfter)
-	if *gitRemoteExitCodeAfter != 0 {
-		*gitRemoteAfter = ""
+	gitAfter, _ := collect.ReadGitInfo(*pwdAfter)
+
+	pipeStatusCodes, err := collect.ParsePipeStatus(*pipeStatus)
+	if err != nil {
+		log.Println("err while parsing pipe status:", err)
 	}
 
 	rec := records.Record{
@@ -121,6 +130,8 @@ func main() {
 			Shlvl:     *shlvl,
 			Shell:     *shell,
 
+			PipeStatus: pipeStatusCodes,
+
 			PwdAfter: *pwdAfter,
 
 			// non-posix
@@ -135,11 +146,14 @@ func main() {
 
 			RealtimeDuration: realtimeDuration,
 
-			GitDirAfter:          gitDirAfter,
-			GitRealDirAfter:      gitRealDirAfter,
-			GitOriginRemoteAfter: *gitRemoteAfter,
+			GitDirAfter:          gitAfter.Dir,
+			GitRealDirAfter:      gitAfter.RealDir,
+			GitOriginRemoteAfter: gitAfter.OriginRemote(),
 			MachineID:            collect.ReadFileContent(machineIDPath),
 
+			GitBranchAfter: gitAfter.Branch,
+			GitCommitAfter: gitAfter.Commit,
+
 			PartOne: false,
 
 			ReshUUID:     collect.ReadFileContent(reshUUIDPath),
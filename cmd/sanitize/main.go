@@ -2,19 +2,26 @@ package main
 
 import (
 	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/url"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"unicode"
@@ -35,12 +42,15 @@ func main() {
 	historyPath := filepath.Join(dir, ".resh_history.json")
 	// outputPath := filepath.Join(dir, "resh_history_sanitized.json")
 	sanitizerDataPath := filepath.Join(dir, ".resh", "sanitizer_data")
+	sanitizerKeyPath := filepath.Join(dir, ".resh", "sanitizer-key")
 
 	showVersion := flag.Bool("version", false, "Show version and exit")
 	showRevision := flag.Bool("revision", false, "Show git revision and exit")
 	trimHashes := flag.Int("trim-hashes", 12, "Trim hashes to N characters, '0' turns off trimming")
 	inputPath := flag.String("input", historyPath, "Input file")
 	outputPath := flag.String("output", "", "Output file (default: use stdout)")
+	keyPath := flag.String("key-file", sanitizerKeyPath, "Secret key for HMAC-SHA256 hashes (generated if it doesn't exist)")
+	legacySHA1 := flag.Bool("legacy-sha1", false, "Use plain SHA1 hashes and sanitization of older versions (to compare with datasets sanitized by older versions)")
 
 	flag.Parse()
 
@@ -52,11 +62,20 @@ func main() {
 		fmt.Println(commit)
 		os.Exit(0)
 	}
-	sanitizer := sanitizer{hashLength: *trimHashes}
+	sanitizer := sanitizer{hashLength: *trimHashes, hashAlgorithm: hashHMACSHA256}
+	if *legacySHA1 {
+		sanitizer.hashAlgorithm = hashSHA1
+	}
 	err := sanitizer.init(sanitizerDataPath)
 	if err != nil {
 		log.Fatal("Sanitizer init() error:", err)
 	}
+	if *legacySHA1 == false {
+		sanitizer.hashKey, err = loadOrCreateKey(*keyPath)
+		if err != nil {
+			log.Fatal("Sanitizer key error:", err)
+		}
+	}
 
 	inputFile, err := os.Open(*inputPath)
 	if err != nil {
@@ -112,9 +131,24 @@ func main() {
 	}
 }
 
+// hash algorithms - noted in sanitized records
+const (
+	hashHMACSHA256 = "hmac-sha256"
+	hashSHA1       = "sha1"
+)
+
+// length of the generated secret key in bytes
+const keyLength = 32
+
+// minimal length of the key read from the key file (hex encoded key has 2 characters per byte)
+const minKeyLength = 32
+
 type sanitizer struct {
-	hashLength int
-	whitelist  map[string]bool
+	hashLength    int
+	hashAlgorithm string
+	// secret key for HMAC - unique for each installation
+	hashKey   []byte
+	whitelist map[string]bool
 }
 
 func (s *sanitizer) init(dataPath string) error {
@@ -123,6 +157,38 @@ func (s *sanitizer) init(dataPath string) error {
 	return nil
 }
 
+// loadOrCreateKey reads secret key from the file or generates a new random key and saves it
+//		the same key has to be used to keep hashes consistent between runs
+//		empty key file (e.g. failed generation during install) is replaced with a new key, short keys are rejected
+func loadOrCreateKey(keyPath string) ([]byte, error) {
+	data, err := ioutil.ReadFile(keyPath)
+	if err == nil {
+		key := strings.TrimSpace(string(data))
+		if len(key) >= minKeyLength {
+			return []byte(key), nil
+		}
+		if len(key) > 0 {
+			return nil, errors.New("key in " + keyPath + " is too short (" + strconv.Itoa(len(key)) +
+				" characters, at least " + strconv.Itoa(minKeyLength) + " expected)")
+		}
+		log.Println("Sanitizer key file is empty:", keyPath)
+	} else if os.IsNotExist(err) == false {
+		return nil, err
+	}
+	randomBytes := make([]byte, keyLength)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+	key := hex.EncodeToString(randomBytes)
+	err = ioutil.WriteFile(keyPath, []byte(key+"\n"), 0600)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Generated new sanitizer key:", keyPath)
+	return []byte(key), nil
+}
+
 func loadData(fname string) map[string]bool {
 	file, err := os.Open(fname)
 	if err != nil {
@@ -149,11 +215,21 @@ func (s *sanitizer) sanitizeRecord(record *records.Record) error {
 	record.GitRealDir = s.sanitizePath(record.GitRealDir)
 	record.Home = s.sanitizePath(record.Home)
 	record.ShellEnv = s.sanitizePath(record.ShellEnv)
+	if record.SessionSummary != nil {
+		for i, dir := range record.SessionSummary.Dirs {
+			record.SessionSummary.Dirs[i] = s.sanitizePath(dir)
+		}
+	}
 
 	// hash the most sensitive info, do not tokenize
 	record.Host = s.hashToken(record.Host)
 	record.Login = s.hashToken(record.Login)
 	record.MachineID = s.hashToken(record.MachineID)
+	record.SSHClient = s.hashToken(record.SSHClient)
+	// extra metadata (virtualenv, kube context, env vars, ...) can be anything
+	for name, value := range record.Extra {
+		record.Extra[name] = s.hashToken(value)
+	}
 
 	var err error
 	// this changes git url a bit but I'm still happy with the result
@@ -164,6 +240,15 @@ func (s *sanitizer) sanitizeRecord(record *records.Record) error {
 		log.Println("Error while snitizing GitOriginRemote url", record.GitOriginRemote, ":", err)
 		return err
 	}
+	for name, url := range record.GitRemotes {
+		record.GitRemotes[name], err = s.sanitizeGitURL(url)
+		if err != nil {
+			log.Println("Error while snitizing GitRemotes url", url, ":", err)
+			return err
+		}
+	}
+	record.GitBranch = s.hashToken(record.GitBranch)
+	record.GitBranchAfter = s.hashToken(record.GitBranchAfter)
 
 	// sanitization destroys original CmdLine length -> save it
 	record.CmdLength = len(record.CmdLine)
@@ -185,6 +270,7 @@ func (s *sanitizer) sanitizeRecord(record *records.Record) error {
 	}
 	// add a flag to signify that the record has been sanitized
 	record.Sanitized = true
+	record.SanitizerHash = s.hashAlgorithm
 	return nil
 }
 
@@ -230,7 +316,158 @@ func (s *sanitizer) sanitizeRecallActions(str string) (string, error) {
 	return sanStr, nil
 }
 
+// cmdLineStructureRegexp finds parts of cmdLines that are sanitized structurally
+//		the match is checked further in sanitizeCmdLine (e.g. IP addresses are validated)
+var cmdLineStructureRegexp = regexp.MustCompile(
+	`(?P<url>[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>|;&()` + "`" + `]+)` +
+		`|(?P<scp>[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^\s"'<>|;&()` + "`" + `]*)` +
+		`|(?P<email>[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)` +
+		`|(?P<ipv6>[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7})` +
+		`|(?P<ipv4>\b(?:[0-9]{1,3}\.){3}[0-9]{1,3}\b)` +
+		`|(?P<path>(?:~|[A-Za-z0-9._][A-Za-z0-9._-]*)?/[^\s"'<>|;&()$` + "`" + `]*)`)
+
+// sanitizeCmdLine sanitizes URLs, email addresses, IP addresses and paths structurally
+//		(e.g. scheme and path shape are kept) and the rest of the cmdLine token by token
+//		legacy mode sanitizes the whole cmdLine token by token to match datasets sanitized by older versions
 func (s *sanitizer) sanitizeCmdLine(cmdLine string) (string, error) {
+	if s.hashAlgorithm == hashSHA1 {
+		return s.sanitizeCmdText(cmdLine)
+	}
+	names := cmdLineStructureRegexp.SubexpNames()
+	sanCmdLine := ""
+	pos := 0
+	for _, match := range cmdLineStructureRegexp.FindAllStringSubmatchIndex(cmdLine, -1) {
+		kind := ""
+		for i := 1; i < len(names); i++ {
+			if match[2*i] >= 0 {
+				kind = names[i]
+				break
+			}
+		}
+		part := cmdLine[match[0]:match[1]]
+		sanPart, ok := s.sanitizeCmdLinePart(kind, part, cmdLine[:match[0]], cmdLine[match[1]:])
+		if ok == false {
+			// not what it looked like (e.g. "std::cout" is not an IPv6 address) => sanitize it as text
+			continue
+		}
+		sanText, err := s.sanitizeCmdText(cmdLine[pos:match[0]])
+		if err != nil {
+			return cmdLine, err
+		}
+		sanCmdLine += sanText + sanPart
+		pos = match[1]
+	}
+	sanText, err := s.sanitizeCmdText(cmdLine[pos:])
+	if err != nil {
+		return cmdLine, err
+	}
+	return sanCmdLine + sanText, nil
+}
+
+// sanitizeCmdLinePart sanitizes structured part of cmdLine
+//		returns false if the part should be sanitized as regular text
+func (s *sanitizer) sanitizeCmdLinePart(kind, part, before, after string) (string, bool) {
+	switch kind {
+	case "url":
+		sanURL, err := s.sanitizeURL(part)
+		if err != nil {
+			log.Println("WARN: got error while sanitizing url in cmdLine:", err)
+			return s.hashToken(part), true
+		}
+		return sanURL, true
+	case "scp":
+		// user@host:path (scp, rsync, git)
+		at := strings.Index(part, "@")
+		colon := at + strings.Index(part[at:], ":")
+		return s.sanitizeToken(part[:at]) + "@" + s.sanitizeHost(part[at+1:colon]) + ":" + s.sanitizeCmdPath(part[colon+1:]), true
+	case "email":
+		at := strings.LastIndex(part, "@")
+		return s.sanitizeToken(part[:at]) + "@" + s.sanitizeHost(part[at+1:]), true
+	case "ipv6":
+		// only standalone addresses (e.g. not "std::cout")
+		if len(before) > 0 && isWordChar(before[len(before)-1]) ||
+			len(after) > 0 && isWordChar(after[0]) ||
+			net.ParseIP(part) == nil {
+			return part, false
+		}
+		return s.sanitizeIP(part), true
+	case "ipv4":
+		if net.ParseIP(part) == nil {
+			return part, false
+		}
+		return s.sanitizeIP(part), true
+	case "path":
+		return s.sanitizeCmdPath(part), true
+	}
+	return part, false
+}
+
+// sanitizeCmdPath sanitizes path from cmdLine
+//		keeps the shape of the path - "/", ".", "..", "~" and whitelisted names and file extensions stay readable
+func (s *sanitizer) sanitizeCmdPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == "~" || segment == "." || segment == ".." || s.isInWhitelist(segment) {
+			continue
+		}
+		dot := strings.LastIndex(segment, ".")
+		if dot > 0 && dot < len(segment)-1 {
+			segments[i] = s.sanitizeToken(segment[:dot]) + "." + s.sanitizeToken(segment[dot+1:])
+			continue
+		}
+		segments[i] = s.sanitizeToken(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sanitizeHost sanitizes host with optional port
+//		parts of hostnames are hashed separately (whitelisted parts e.g. "com" stay readable)
+func (s *sanitizer) sanitizeHost(host string) string {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	bracketed := strings.HasPrefix(hostname, "[") && strings.HasSuffix(hostname, "]")
+	hostname = strings.TrimSuffix(strings.TrimPrefix(hostname, "["), "]")
+
+	var sanHost string
+	if net.ParseIP(hostname) != nil {
+		sanHost = s.sanitizeIP(hostname)
+		// IPv6 addresses in URLs are in brackets
+		bracketed = bracketed || strings.Contains(hostname, ":")
+	} else {
+		labels := strings.Split(hostname, ".")
+		for i, label := range labels {
+			labels[i] = s.sanitizeToken(label)
+		}
+		sanHost = strings.Join(labels, ".")
+	}
+	if bracketed {
+		sanHost = "[" + sanHost + "]"
+	}
+	if port != "" {
+		sanHost += ":" + s.sanitizeToken(port)
+	}
+	return sanHost
+}
+
+// sanitizeIP hashes the IP address as a whole
+//		loopback and unspecified addresses (e.g. 127.0.0.1, ::1, 0.0.0.0) stay readable
+func (s *sanitizer) sanitizeIP(ip string) string {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP != nil && (parsedIP.IsLoopback() || parsedIP.IsUnspecified()) {
+		return ip
+	}
+	return s.hashToken(ip)
+}
+
+func isWordChar(c byte) bool {
+	return unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || strings.ContainsRune("._:", rune(c))
+}
+
+// sanitizeCmdText sanitizes cmdLine (or its part) token by token
+//		simple options (e.g. "-a", "--long-option") stay readable
+func (s *sanitizer) sanitizeCmdText(cmdLine string) (string, error) {
 	const optionEndingChars = "\"$'\\#[]!><|;{}()*,?~&=`:@^/+%." // all bash control characters, '=', ...
 	const optionAllowedChars = "-_"                              // characters commonly found inside of options
 	sanCmdLine := ""
@@ -349,10 +586,15 @@ func (s *sanitizer) sanitizeParsedURL(parsedURL *url.URL) (string, error) {
 		// we need to do this because `gitUrls.Parse()` sets `User` to `url.User("")` instead of `nil`
 		parsedURL.User = nil
 	}
-	var err error
-	parsedURL.Host, err = s.sanitizeTwoPartToken(parsedURL.Host, ":")
-	if err != nil {
-		return parsedURL.String(), err
+	if s.hashAlgorithm == hashSHA1 {
+		// older versions hashed the host as a whole
+		var err error
+		parsedURL.Host, err = s.sanitizeTwoPartToken(parsedURL.Host, ":")
+		if err != nil {
+			return parsedURL.String(), err
+		}
+	} else {
+		parsedURL.Host = s.sanitizeHost(parsedURL.Host)
 	}
 	parsedURL.Path = s.sanitizePath(parsedURL.Path)
 	// ForceQuery bool
@@ -442,8 +684,7 @@ func (s *sanitizer) hashToken(token string) string {
 	if len(token) <= 0 {
 		return token
 	}
-	// hash with sha1
-	h := sha1.New()
+	h := s.newHash()
 	h.Write([]byte(token))
 	sum := h.Sum(nil)
 	return s.trimHash(hex.EncodeToString(sum))
@@ -453,7 +694,7 @@ func (s *sanitizer) hashNumericToken(token string) string {
 	if len(token) <= 0 {
 		return token
 	}
-	h := sha1.New()
+	h := s.newHash()
 	h.Write([]byte(token))
 	sum := h.Sum(nil)
 	sumInt := int(binary.LittleEndian.Uint64(sum))
@@ -463,6 +704,14 @@ func (s *sanitizer) hashNumericToken(token string) string {
 	return s.trimHash(strconv.Itoa(sumInt))
 }
 
+// newHash returns HMAC-SHA256 keyed with the secret key or plain SHA1 in legacy mode
+func (s *sanitizer) newHash() hash.Hash {
+	if s.hashAlgorithm == hashSHA1 {
+		return sha1.New()
+	}
+	return hmac.New(sha256.New, s.hashKey)
+}
+
 func (s *sanitizer) trimHash(hash string) string {
 	length := s.hashLength
 	if length <= 0 || len(hash) < length {
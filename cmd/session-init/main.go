@@ -43,6 +43,7 @@ func main() {
 	shell := flag.String("shell", "", "actual shell")
 	uname := flag.String("uname", "", "uname")
 	sessionID := flag.String("sessionId", "", "resh generated session id")
+	parentSessionID := flag.String("parentSessionId", "", "resh session id inherited from the parent session (e.g. nested shell, tmux)")
 
 	// posix variables
 	cols := flag.String("cols", "-1", "$COLUMNS")
@@ -80,8 +81,14 @@ func main() {
 		"on session start $EPOCHREALTIME")
 	rtsessboot := flag.String("realtimeSessSinceBoot", "-1",
 		"on session start $EPOCHREALTIME")
+	input := flag.String("input", collect.InputFlags,
+		"also read values from 'json' object on stdin or from 'env' variables (e.g. RESH_CMD_LINE) - options take precedence")
 	flag.Parse()
 
+	if err := collect.ReadInput(flag.CommandLine, *input, os.Stdin, os.Environ()); err != nil {
+		log.Fatal("Input error: ", err)
+	}
+
 	if *showVersion == true {
 		fmt.Println(version)
 		os.Exit(0)
@@ -132,6 +139,8 @@ func main() {
 		*osReleasePrettyName = "Linux"
 	}
 
+	sessionInfo := collect.ReadSessionInfo(os.Environ())
+
 	rec := records.Record{
 		// posix
 		Cols:  *cols,
@@ -160,6 +169,12 @@ func main() {
 			Machtype:   *machtype,
 			Shlvl:      *shlvl,
 
+			ParentSessionID: *parentSessionID,
+			TmuxSession:     sessionInfo.TmuxSession,
+			TmuxWindow:      sessionInfo.TmuxWindow,
+			TmuxPane:        sessionInfo.TmuxPane,
+			SSHClient:       sessionInfo.SSHClient,
+
 			// before after
 			TimezoneBefore: *timezoneBefore,
 
@@ -1,12 +1,54 @@
 package cfg
 
+import "github.com/curusarn/resh/pkg/records"
+
 // Config struct
 type Config struct {
-	Port                    int
-	SesswatchPeriodSeconds  uint
-	SesshistInitHistorySize int
-	Debug                   bool
-	BindArrowKeysBash       bool
-	BindArrowKeysZsh        bool
-	BindControlR            bool
+	Port                         int
+	SesswatchPeriodSeconds       uint
+	SesshistInitHistorySize      int
+	SesshistShareHistory         string
+	SesshistPersistPeriodSeconds uint
+	Debug                        bool
+	BindArrowKeysBash            bool
+	BindArrowKeysZsh             bool
+	BindArrowKeysFish            bool
+	BindControlR                 bool
+	Collectors                   []string
+	CollectEnv                   []string
+	GitDirty                     bool
+	Cli                          CliConfig
+	Scrub                        ScrubConfig
+}
+
+// CliConfig - configuration of resh-cli
+type CliConfig struct {
+	// DefaultScope - one of: session, dir, subdirs, git, host, global
+	DefaultScope string
+	// KeyPreset - emacs or vi
+	KeyPreset string
+	// Keys - action -> key or list of keys (e.g. next = ["down", "ctrl-n"])
+	//		keys for vi normal mode are in nested table (e.g. [cli.keys.normal])
+	Keys map[string]interface{}
+	// ContextWeight - weight of the context score in the ranking (0 turns context ranking off)
+	ContextWeight float64
+	// ContextDistParams - weights used to compute distance of the records from the current context
+	ContextDistParams records.DistParams
+}
+
+// ScrubConfig - configuration of secret scrubbing in resh-daemon
+type ScrubConfig struct {
+	// Enabled - scrub secrets from records before they are saved
+	Enabled bool
+	// Action - redact (replace secrets with [REDACTED]) or drop (don't save the record at all)
+	Action string
+	// DisabledDetectors - names of built-in detectors to turn off (e.g. ["entropy", "password-flag"])
+	DisabledDetectors []string
+	// Patterns - additional detectors - name -> regexp
+	//		secret is the first capture group or the whole match
+	Patterns map[string]string
+	// EntropyThreshold - minimal shannon entropy (bits per char) of random-looking tokens to be redacted (0 turns entropy detection off)
+	EntropyThreshold float64
+	// EntropyMinLength - minimal length of tokens checked by the entropy detector
+	EntropyMinLength int
 }
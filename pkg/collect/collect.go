@@ -6,7 +6,6 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -17,10 +16,12 @@ import (
 type SingleResponse struct {
 	Found   bool   `json:"found"`
 	CmdLine string `json:"cmdline"`
+	// Shared is true if the command comes from another session
+	Shared bool `json:"shared,omitempty"`
 }
 
 // SendRecallRequest to daemon
-func SendRecallRequest(r records.SlimRecord, port string) (string, bool) {
+func SendRecallRequest(r records.SlimRecord, port string) SingleResponse {
 	recJSON, err := json.Marshal(r)
 	if err != nil {
 		log.Fatal("send err 1", err)
@@ -51,7 +52,7 @@ func SendRecallRequest(r records.SlimRecord, port string) (string, bool) {
 		log.Fatal("unmarshal resp error: ", err)
 	}
 	log.Println(response)
-	return response.CmdLine, response.Found
+	return response
 }
 
 // SendRecord to daemon
@@ -85,23 +86,13 @@ func ReadFileContent(path string) string {
 	return strings.TrimSuffix(string(dat), "\n")
 }
 
-// GetGitDirs based on result of git "cdup" command
-func GetGitDirs(cdup string, exitCode int, pwd string) (string, string) {
-	if exitCode != 0 {
-		return "", ""
-	}
-	abspath := filepath.Clean(filepath.Join(pwd, cdup))
-	realpath, err := filepath.EvalSymlinks(abspath)
-	if err != nil {
-		log.Println("err while handling git dir paths:", err)
-		return "", ""
-	}
-	return abspath, realpath
-}
-
 // GetTimezoneOffsetInSeconds based on zone returned by date command
 func GetTimezoneOffsetInSeconds(zone string) float64 {
 	// date +%z -> "+0200"
+	if len(zone) < 5 {
+		log.Println("err while parsing timezone offset: unexpected format:", zone)
+		return -1
+	}
 	hoursStr := zone[:3]
 	minsStr := zone[3:]
 	hours, err := strconv.Atoi(hoursStr)
@@ -117,3 +108,21 @@ func GetTimezoneOffsetInSeconds(zone string) float64 {
 	secs := ((hours * 60) + mins) * 60
 	return float64(secs)
 }
+
+// ParsePipeStatus parses exit codes of pipeline commands (e.g. "0 1" from "${PIPESTATUS[*]}")
+//		returns nil for commands that are not pipelines (single exit code)
+func ParsePipeStatus(str string) ([]int, error) {
+	fields := strings.Fields(str)
+	if len(fields) < 2 {
+		return nil, nil
+	}
+	var pipeStatus []int
+	for _, field := range fields {
+		status, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		pipeStatus = append(pipeStatus, status)
+	}
+	return pipeStatus, nil
+}
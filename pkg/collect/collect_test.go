@@ -0,0 +1,28 @@
+package collect
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePipeStatus(t *testing.T) {
+	data := map[string][]int{
+		"":        nil,
+		"0":       nil,
+		"1":       nil,
+		"0 1":     {0, 1},
+		" 2 0 0 ": {2, 0, 0},
+	}
+	for str, expected := range data {
+		pipeStatus, err := ParsePipeStatus(str)
+		if err != nil {
+			t.Error("ParsePipeStatus() failed:", str, err)
+		}
+		if reflect.DeepEqual(pipeStatus, expected) == false {
+			t.Error("Expected:", expected, "- got:", pipeStatus, "- for:", str)
+		}
+	}
+	if _, err := ParsePipeStatus("0 x"); err == nil {
+		t.Error("Expected error for invalid exit code")
+	}
+}
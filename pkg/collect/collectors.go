@@ -0,0 +1,196 @@
+package collect
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Keys of the extra metadata produced by built-in collectors
+const (
+	// ExtraVirtualenv - name of active python virtualenv
+	ExtraVirtualenv = "virtualenv"
+	// ExtraConda - name of active conda environment
+	ExtraConda = "conda"
+	// ExtraKubeContext - current context from kubeconfig
+	ExtraKubeContext = "kubeContext"
+	// ExtraAwsProfile - active AWS profile
+	ExtraAwsProfile = "awsProfile"
+	// ExtraEnvPrefix - prefix of keys produced by env collector (e.g. "env.TF_WORKSPACE")
+	ExtraEnvPrefix = "env."
+)
+
+// Collector adds extra metadata to the record
+type Collector interface {
+	// Name of the collector used in the config
+	Name() string
+	// Collect returns metadata based on environment of the command - empty values are dropped
+	Collect(env map[string]string) map[string]string
+}
+
+var collectors = map[string]func() Collector{
+	"virtualenv": func() Collector { return virtualenvCollector{} },
+	"kube":       func() Collector { return kubeCollector{} },
+	"aws":        func() Collector { return awsCollector{} },
+}
+
+// RegisterCollector makes collector available under given name
+func RegisterCollector(name string, newCollector func() Collector) {
+	collectors[name] = newCollector
+}
+
+// NewCollectors creates collectors based on names from the config
+//		env allowlist adds collector of listed environment variables
+//		unknown names are skipped and reported in the returned error
+func NewCollectors(names []string, envAllowlist []string) ([]Collector, error) {
+	var res []Collector
+	var unknown []string
+	for _, name := range names {
+		newCollector, found := collectors[name]
+		if found == false {
+			unknown = append(unknown, name)
+			continue
+		}
+		res = append(res, newCollector())
+	}
+	if len(envAllowlist) > 0 {
+		res = append(res, envCollector{allowlist: envAllowlist})
+	}
+	if len(unknown) > 0 {
+		var known []string
+		for name := range collectors {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return res, errors.New("unknown collectors: " + strings.Join(unknown, ", ") +
+			" (available: " + strings.Join(known, ", ") + ")")
+	}
+	return res, nil
+}
+
+// CollectExtra runs all collectors and returns their merged output (nil when there is nothing)
+//		environ is a list of "NAME=value" strings (e.g. os.Environ())
+func CollectExtra(collectors []Collector, environ []string) map[string]string {
+	env := envMap(environ)
+	var extra map[string]string
+	for _, c := range collectors {
+		for key, value := range c.Collect(env) {
+			if value == "" {
+				continue
+			}
+			if extra == nil {
+				extra = map[string]string{}
+			}
+			extra[key] = value
+		}
+	}
+	return extra
+}
+
+// envMap converts list of "NAME=value" strings to map
+func envMap(environ []string) map[string]string {
+	env := map[string]string{}
+	for _, item := range environ {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env
+}
+
+type virtualenvCollector struct{}
+
+func (c virtualenvCollector) Name() string {
+	return "virtualenv"
+}
+
+func (c virtualenvCollector) Collect(env map[string]string) map[string]string {
+	res := map[string]string{}
+	if venv := env["VIRTUAL_ENV"]; venv != "" {
+		res[ExtraVirtualenv] = filepath.Base(venv)
+	}
+	// base conda environment is active in most conda shells - not interesting
+	if conda := env["CONDA_DEFAULT_ENV"]; conda != "" && conda != "base" {
+		res[ExtraConda] = conda
+	}
+	return res
+}
+
+type awsCollector struct{}
+
+func (c awsCollector) Name() string {
+	return "aws"
+}
+
+func (c awsCollector) Collect(env map[string]string) map[string]string {
+	profile := env["AWS_PROFILE"]
+	if profile == "" {
+		profile = env["AWS_DEFAULT_PROFILE"]
+	}
+	return map[string]string{ExtraAwsProfile: profile}
+}
+
+type kubeCollector struct{}
+
+func (c kubeCollector) Name() string {
+	return "kube"
+}
+
+func (c kubeCollector) Collect(env map[string]string) map[string]string {
+	var paths []string
+	if kubeconfig := env["KUBECONFIG"]; kubeconfig != "" {
+		paths = filepath.SplitList(kubeconfig)
+	} else if home := env["HOME"]; home != "" {
+		paths = []string{filepath.Join(home, ".kube", "config")}
+	}
+	// kubectl uses current-context from the first file that sets it
+	for _, path := range paths {
+		if context := readKubeCurrentContext(path); context != "" {
+			return map[string]string{ExtraKubeContext: context}
+		}
+	}
+	return nil
+}
+
+// readKubeCurrentContext returns top level "current-context" from kubeconfig
+//		avoids pulling in a yaml parser - kubeconfig files written by kubectl keep it on a single line
+func readKubeCurrentContext(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "current-context:") == false {
+			continue
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(line, "current-context:"))
+		if idx := strings.Index(value, " #"); idx != -1 {
+			value = strings.TrimSpace(value[:idx])
+		}
+		return strings.Trim(value, `"'`)
+	}
+	return ""
+}
+
+type envCollector struct {
+	allowlist []string
+}
+
+func (c envCollector) Name() string {
+	return "env"
+}
+
+func (c envCollector) Collect(env map[string]string) map[string]string {
+	res := map[string]string{}
+	for _, name := range c.allowlist {
+		res[ExtraEnvPrefix+name] = env[name]
+	}
+	return res
+}
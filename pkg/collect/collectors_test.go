@@ -0,0 +1,73 @@
+package collect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectExtra(t *testing.T) {
+	collectors, err := NewCollectors([]string{"virtualenv", "aws"}, []string{"TF_WORKSPACE", "UNSET"})
+	if err != nil {
+		t.Fatal("NewCollectors() failed:", err)
+	}
+	environ := []string{
+		"VIRTUAL_ENV=/home/user/proj/.venv",
+		"CONDA_DEFAULT_ENV=base",
+		"AWS_DEFAULT_PROFILE=default",
+		"AWS_PROFILE=prod",
+		"TF_WORKSPACE=staging",
+		"PATH=/bin",
+	}
+	extra := CollectExtra(collectors, environ)
+	expected := map[string]string{
+		ExtraVirtualenv:                 ".venv",
+		ExtraAwsProfile:                 "prod",
+		ExtraEnvPrefix + "TF_WORKSPACE": "staging",
+	}
+	if len(extra) != len(expected) {
+		t.Error("Unexpected extra:", extra)
+	}
+	for key, value := range expected {
+		if extra[key] != value {
+			t.Error("Expected:", key, "=", value, "- got:", extra[key])
+		}
+	}
+	if extra := CollectExtra(collectors, []string{"PATH=/bin"}); extra != nil {
+		t.Error("Expected nil when there is nothing to collect - got:", extra)
+	}
+}
+
+func TestNewCollectorsUnknown(t *testing.T) {
+	collectors, err := NewCollectors([]string{"kube", "gcloud"}, nil)
+	if err == nil {
+		t.Error("Expected error for unknown collector")
+	}
+	if len(collectors) != 1 || collectors[0].Name() != "kube" {
+		t.Error("Known collectors should be kept:", collectors)
+	}
+}
+
+func TestKubeCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resh-test-kube")
+	if err != nil {
+		t.Fatal("TempDir() failed:", err)
+	}
+	defer os.RemoveAll(dir)
+	empty := filepath.Join(dir, "empty")
+	config := filepath.Join(dir, "config")
+	ioutil.WriteFile(empty, []byte("apiVersion: v1\nkind: Config\n"), 0644)
+	ioutil.WriteFile(config, []byte("apiVersion: v1\ncontexts:\n- context:\n    cluster: dev\n  name: dev\n"+
+		"current-context: \"dev-cluster\" # set by kubectl\nkind: Config\n"), 0644)
+
+	c := kubeCollector{}
+	env := map[string]string{"KUBECONFIG": empty + string(filepath.ListSeparator) + config}
+	if context := c.Collect(env)[ExtraKubeContext]; context != "dev-cluster" {
+		t.Error("Expected context from the first file that sets it - got:", context)
+	}
+	env = map[string]string{"HOME": dir}
+	if res := c.Collect(env); len(res) != 0 {
+		t.Error("Expected no context without kubeconfig - got:", res)
+	}
+}
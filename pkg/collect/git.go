@@ -0,0 +1,282 @@
+package collect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// GitInfo describes git repository of a directory
+type GitInfo struct {
+	// Dir - top level directory of the working tree
+	Dir     string
+	RealDir string
+	// Branch - empty when HEAD is detached
+	Branch string
+	// Commit - HEAD commit, empty in repository without commits
+	Commit string
+	// Dirty - tracked files were changed, staged, deleted or are in conflict (untracked files are not considered)
+	//		not set by ReadGitInfo - see IsGitDirty
+	Dirty bool
+	// Remotes - remote name -> url
+	Remotes map[string]string
+}
+
+// OriginRemote returns url of the "origin" remote
+func (g GitInfo) OriginRemote() string {
+	return g.Remotes["origin"]
+}
+
+// ReadGitInfo reads git metadata of the repository containing the directory
+//		branch, commit and remotes are read from .git directly (works with worktrees and submodules)
+//		dirty flag is not read - it needs "git status" which is too slow to run in every hook
+//		returns false when the directory is not in a git working tree
+func ReadGitInfo(pwd string) (GitInfo, bool) {
+	var info GitInfo
+	if pwd == "" {
+		return info, false
+	}
+	workTree, gitDir, found := findGitDir(pwd)
+	if found == false {
+		// pwd can be a symlink into a repository
+		realPwd, err := filepath.EvalSymlinks(pwd)
+		if err != nil || realPwd == pwd {
+			return info, false
+		}
+		workTree, gitDir, found = findGitDir(realPwd)
+		if found == false {
+			return info, false
+		}
+	}
+	info.Dir = workTree
+	realDir, err := filepath.EvalSymlinks(workTree)
+	if err != nil {
+		log.Println("err while handling git dir paths:", err)
+		return info, false
+	}
+	info.RealDir = realDir
+
+	commonDir := gitCommonDir(gitDir)
+	config, err := readGitConfig(filepath.Join(commonDir, "config"))
+	if err != nil {
+		log.Println("err while reading git config:", err)
+	}
+	info.Remotes = config.remotes
+	info.Branch, info.Commit, err = readGitHead(gitDir, commonDir)
+	if err != nil {
+		log.Println("err while reading git HEAD:", err)
+	}
+	return info, true
+}
+
+// findGitDir looks for .git in the directory and its parents
+//		.git can be a directory or a file pointing to the git dir (worktrees, submodules)
+func findGitDir(dir string) (string, string, bool) {
+	dir = filepath.Clean(dir)
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		fi, err := os.Stat(dotGit)
+		if err == nil {
+			gitDir := dotGit
+			if fi.IsDir() == false {
+				gitDir = readGitDirFile(dotGit)
+			}
+			if gitDir != "" && isGitDir(gitDir) {
+				return dir, gitDir, true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", false
+		}
+		dir = parent
+	}
+}
+
+// readGitDirFile returns git dir from .git file (e.g. "gitdir: ../.git/modules/sub")
+func readGitDirFile(path string) string {
+	content := ReadFileContent(path)
+	if strings.HasPrefix(content, "gitdir:") == false {
+		return ""
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(content, "gitdir:"))
+	if filepath.IsAbs(gitDir) == false {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	return filepath.Clean(gitDir)
+}
+
+func isGitDir(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "HEAD"))
+	return err == nil
+}
+
+// gitCommonDir returns directory with refs and config shared by all worktrees
+func gitCommonDir(gitDir string) string {
+	commonDir := ReadFileContent(filepath.Join(gitDir, "commondir"))
+	if commonDir == "" {
+		return gitDir
+	}
+	if filepath.IsAbs(commonDir) == false {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	return filepath.Clean(commonDir)
+}
+
+type gitConfig struct {
+	remotes map[string]string
+}
+
+// readGitConfig reads the parts of git config we care about
+//		includes and url rewrites are not supported
+func readGitConfig(path string) (gitConfig, error) {
+	config := gitConfig{}
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+	section := ""
+	subsection := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.LastIndex(line, "]")
+			if end == -1 {
+				continue
+			}
+			header := strings.TrimSpace(line[1:end])
+			section, subsection = header, ""
+			if idx := strings.IndexAny(header, " \t"); idx != -1 {
+				section = header[:idx]
+				subsection = strings.Trim(strings.TrimSpace(header[idx:]), `"`)
+			}
+			section = strings.ToLower(section)
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := gitConfigValue(parts[1])
+		if section == "remote" && key == "url" && subsection != "" {
+			if config.remotes == nil {
+				config.remotes = map[string]string{}
+			}
+			// first url is used for fetching
+			if _, found := config.remotes[subsection]; found == false {
+				config.remotes[subsection] = value
+			}
+		}
+	}
+	return config, scanner.Err()
+}
+
+// gitConfigValue strips comments and quotes from the value
+func gitConfigValue(raw string) string {
+	var value strings.Builder
+	quoted := false
+	escaped := false
+	for _, r := range strings.TrimSpace(raw) {
+		switch {
+		case escaped:
+			value.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case (r == '#' || r == ';') && quoted == false:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(value.String())
+}
+
+// readGitHead returns current branch and HEAD commit
+func readGitHead(gitDir, commonDir string) (string, string, error) {
+	head := ReadFileContent(filepath.Join(gitDir, "HEAD"))
+	if head == "" {
+		return "", "", errors.New("empty HEAD")
+	}
+	if strings.HasPrefix(head, "ref:") == false {
+		// detached HEAD
+		return "", head, nil
+	}
+	ref := strings.TrimSpace(strings.TrimPrefix(head, "ref:"))
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	return branch, resolveGitRef(gitDir, commonDir, ref), nil
+}
+
+// resolveGitRef returns commit the ref points to (empty for unborn branches)
+func resolveGitRef(gitDir, commonDir, ref string) string {
+	// symbolic refs can point to other symbolic refs
+	for depth := 0; depth < 5; depth++ {
+		content := ReadFileContent(filepath.Join(gitDir, filepath.FromSlash(ref)))
+		if content == "" {
+			content = ReadFileContent(filepath.Join(commonDir, filepath.FromSlash(ref)))
+		}
+		if content == "" {
+			return readPackedRef(commonDir, ref)
+		}
+		if strings.HasPrefix(content, "ref:") == false {
+			return content
+		}
+		ref = strings.TrimSpace(strings.TrimPrefix(content, "ref:"))
+	}
+	return ""
+}
+
+func readPackedRef(commonDir, ref string) string {
+	file, err := os.Open(filepath.Join(commonDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) == 2 && parts[1] == ref {
+			return parts[0]
+		}
+	}
+	return ""
+}
+
+// gitStatusTimeout - dirty flag is left unset when git status takes longer (e.g. huge repositories)
+const gitStatusTimeout = time.Second
+
+// IsGitDirty runs "git status" in the working tree
+//		git handles filters, autocrlf, LFS, split index, untracked cache and fsmonitor for us
+//		untracked files and dirty submodule contents are not considered
+func IsGitDirty(workTree string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitStatusTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain", "--untracked-files=no", "--ignore-submodules=dirty")
+	cmd.Dir = workTree
+	// don't refresh the index - we should not race with git commands run by the user
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+	return len(bytes.TrimSpace(out)) > 0, nil
+}
@@ -0,0 +1,250 @@
+package collect
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t testing.TB, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal("MkdirAll() failed:", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal("WriteFile() failed:", err)
+	}
+}
+
+func testTempDir(t testing.TB) string {
+	dir, err := ioutil.TempDir("", "resh-test-git")
+	if err != nil {
+		t.Fatal("TempDir() failed:", err)
+	}
+	// git dirs are compared with real paths (e.g. /tmp can be a symlink)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal("EvalSymlinks() failed:", err)
+	}
+	return dir
+}
+
+func TestReadGitInfoRefs(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	writeTestFile(t, filepath.Join(dir, ".git/HEAD"), "ref: refs/heads/feature/x\n")
+	writeTestFile(t, filepath.Join(dir, ".git/packed-refs"),
+		"# pack-refs with: peeled fully-peeled sorted\n"+commit+" refs/heads/feature/x\n^"+commit+"\n")
+	writeTestFile(t, filepath.Join(dir, ".git/config"), "[core]\n\tbare = false\n"+
+		"[remote \"origin\"]\n\turl = git@github.com:curusarn/resh.git\n\tfetch = +refs/heads/*:refs/remotes/origin/*\n"+
+		"[remote \"fork\"]\n\turl = \"https://example.com/resh.git\" ; comment\n")
+	writeTestFile(t, filepath.Join(dir, "a/b/file"), "")
+
+	info, found := ReadGitInfo(filepath.Join(dir, "a/b"))
+	if found == false {
+		t.Fatal("ReadGitInfo() should find the repository")
+	}
+	if info.Dir != dir || info.RealDir != dir {
+		t.Error("Unexpected dirs:", info.Dir, info.RealDir)
+	}
+	if info.Branch != "feature/x" || info.Commit != commit {
+		t.Error("Unexpected HEAD:", info.Branch, info.Commit)
+	}
+	if info.OriginRemote() != "git@github.com:curusarn/resh.git" || info.Remotes["fork"] != "https://example.com/resh.git" {
+		t.Error("Unexpected remotes:", info.Remotes)
+	}
+
+	// loose ref takes precedence over packed one
+	writeTestFile(t, filepath.Join(dir, ".git/refs/heads/feature/x"), strings.Repeat("f", 40)+"\n")
+	if info, _ := ReadGitInfo(dir); info.Commit != strings.Repeat("f", 40) {
+		t.Error("Unexpected commit:", info.Commit)
+	}
+	// detached HEAD
+	writeTestFile(t, filepath.Join(dir, ".git/HEAD"), commit+"\n")
+	if info, _ := ReadGitInfo(dir); info.Branch != "" || info.Commit != commit {
+		t.Error("Unexpected detached HEAD:", info.Branch, info.Commit)
+	}
+}
+
+func TestReadGitInfoNotRepository(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	if _, found := ReadGitInfo(dir); found {
+		t.Error("ReadGitInfo() should not find repository in:", dir)
+	}
+	if _, found := ReadGitInfo(""); found {
+		t.Error("ReadGitInfo() should not find repository for empty pwd")
+	}
+}
+
+func runTestGit(t testing.TB, dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatal("git", args, "failed:", err, string(out))
+	}
+}
+
+func newTestRepo(t *testing.T, dir string) {
+	runTestGit(t, dir, "init", "-q")
+	runTestGit(t, dir, "checkout", "-q", "-b", "main")
+	writeTestFile(t, filepath.Join(dir, "file"), "content\n")
+	writeTestFile(t, filepath.Join(dir, "sub/dir/other"), "other\n")
+	runTestGit(t, dir, "add", ".")
+	runTestGit(t, dir, "commit", "-q", "-m", "init")
+}
+
+func isTestRepoDirty(t *testing.T, dir string) bool {
+	dirty, err := IsGitDirty(dir)
+	if err != nil {
+		t.Fatal("IsGitDirty() failed:", err)
+	}
+	return dirty
+}
+
+func TestIsGitDirty(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for _, indexVersion := range []string{"2", "4"} {
+		dir := testTempDir(t)
+		defer os.RemoveAll(dir)
+		newTestRepo(t, dir)
+		runTestGit(t, dir, "update-index", "--index-version", indexVersion)
+		// make sure files are not racily clean
+		runTestGit(t, dir, "update-index", "--really-refresh")
+
+		info, found := ReadGitInfo(filepath.Join(dir, "sub"))
+		if found == false || info.Branch != "main" || len(info.Commit) != 40 {
+			t.Fatal("Unexpected info:", found, info)
+		}
+		if isTestRepoDirty(t, dir) {
+			t.Error("Clean repository should not be dirty - index version:", indexVersion)
+		}
+		writeTestFile(t, filepath.Join(dir, "untracked"), "")
+		if isTestRepoDirty(t, dir) {
+			t.Error("Untracked files should not make repository dirty")
+		}
+		writeTestFile(t, filepath.Join(dir, "sub/dir/other"), "changed\n")
+		if isTestRepoDirty(t, dir) == false {
+			t.Error("Modified file should make repository dirty - index version:", indexVersion)
+		}
+		runTestGit(t, dir, "add", ".")
+		if isTestRepoDirty(t, dir) == false {
+			t.Error("Staged change should make repository dirty - index version:", indexVersion)
+		}
+		runTestGit(t, dir, "reset", "-q", "--hard")
+		os.Remove(filepath.Join(dir, "file"))
+		if isTestRepoDirty(t, dir) == false {
+			t.Error("Deleted file should make repository dirty - index version:", indexVersion)
+		}
+	}
+}
+
+func TestIsGitDirtySplitIndex(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	newTestRepo(t, dir)
+	runTestGit(t, dir, "update-index", "--split-index")
+	if isTestRepoDirty(t, dir) {
+		t.Error("Clean repository with split index should not be dirty")
+	}
+	writeTestFile(t, filepath.Join(dir, "file"), "changed\n")
+	if isTestRepoDirty(t, dir) == false {
+		t.Error("Modified file should make repository with split index dirty")
+	}
+}
+
+func TestIsGitDirtyAutocrlf(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	runTestGit(t, dir, "init", "-q")
+	runTestGit(t, dir, "config", "core.autocrlf", "true")
+	// blob is stored with LF but the working tree file has CRLF
+	writeTestFile(t, filepath.Join(dir, "file.txt"), "line\r\nother\r\n")
+	runTestGit(t, dir, "add", ".")
+	runTestGit(t, dir, "commit", "-q", "-m", "init")
+	// change mtime so the file has to be compared by content
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "file.txt"), future, future); err != nil {
+		t.Fatal("Chtimes() failed:", err)
+	}
+	if isTestRepoDirty(t, dir) {
+		t.Error("CRLF file in autocrlf repository should not be dirty")
+	}
+	writeTestFile(t, filepath.Join(dir, "file.txt"), "line\r\nchanged\r\n")
+	if isTestRepoDirty(t, dir) == false {
+		t.Error("Modified file in autocrlf repository should be dirty")
+	}
+}
+
+func BenchmarkIsGitDirtyLargeIndex(b *testing.B) {
+	if _, err := exec.LookPath("git"); err != nil {
+		b.Skip("git is not installed")
+	}
+	dir := testTempDir(b)
+	defer os.RemoveAll(dir)
+	runTestGit(b, dir, "init", "-q")
+	for i := 0; i < 20000; i++ {
+		writeTestFile(b, filepath.Join(dir, "dir"+strconv.Itoa(i%100), "file"+strconv.Itoa(i)), strconv.Itoa(i)+"\n")
+	}
+	runTestGit(b, dir, "add", ".")
+	runTestGit(b, dir, "commit", "-q", "-m", "init")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if dirty, err := IsGitDirty(dir); err != nil || dirty {
+			b.Fatal("Unexpected dirty flag:", dirty, err)
+		}
+	}
+}
+
+func TestReadGitInfoWorktreeAndSubmodule(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "main")
+	os.Mkdir(main, 0755)
+	newTestRepo(t, main)
+	runTestGit(t, main, "remote", "add", "origin", "https://example.com/main.git")
+
+	worktree := filepath.Join(dir, "wt")
+	runTestGit(t, main, "worktree", "add", "-q", "-b", "topic", worktree)
+	info, found := ReadGitInfo(worktree)
+	if found == false || info.Dir != worktree || info.Branch != "topic" || len(info.Commit) != 40 {
+		t.Error("Unexpected worktree info:", found, info)
+	}
+	if info.OriginRemote() != "https://example.com/main.git" {
+		t.Error("Worktree should use remotes of the main repository:", info.Remotes)
+	}
+
+	lib := filepath.Join(dir, "lib")
+	os.Mkdir(lib, 0755)
+	newTestRepo(t, lib)
+	runTestGit(t, main, "-c", "protocol.file.allow=always", "submodule", "add", "-q", lib, "lib")
+	info, found = ReadGitInfo(filepath.Join(main, "lib"))
+	if found == false || info.Dir != filepath.Join(main, "lib") || info.Branch != "main" || info.OriginRemote() != lib {
+		t.Error("Unexpected submodule info:", found, info)
+	}
+	info, _ = ReadGitInfo(main)
+	if info.Dir != main {
+		t.Error("Unexpected main repository dir:", info.Dir)
+	}
+}
@@ -0,0 +1,146 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// input modes of collectors
+const (
+	// InputFlags - values are only read from command line options (default)
+	InputFlags = ""
+	// InputJSON - values are read from JSON object on stdin
+	InputJSON = "json"
+	// InputEnv - values are read from RESH_* environment variables
+	InputEnv = "env"
+)
+
+// EnvPrefix is a prefix of environment variables read by collectors
+const EnvPrefix = "RESH_"
+
+// EnvName returns name of environment variable for given option
+//		e.g. cmdLine -> RESH_CMD_LINE, recall-actions -> RESH_RECALL_ACTIONS
+func EnvName(option string) string {
+	var name []rune
+	prevLower := false
+	for _, r := range option {
+		if r == '-' || r == '_' {
+			name = append(name, '_')
+			prevLower = false
+			continue
+		}
+		if unicode.IsUpper(r) && prevLower {
+			name = append(name, '_')
+		}
+		prevLower = unicode.IsLower(r) || unicode.IsDigit(r)
+		name = append(name, unicode.ToUpper(r))
+	}
+	return EnvPrefix + string(name)
+}
+
+// ReadInput sets options that were not set on the command line from JSON on stdin or from environment variables
+//		keys of the JSON object are option names (e.g. {"cmdLine": "ls", "exitCode": 0})
+//		environment variables are option names with prefix (e.g. RESH_CMD_LINE=ls, RESH_EXIT_CODE=0)
+//		values are validated by the options - unknown keys/variables are ignored
+func ReadInput(fs *flag.FlagSet, mode string, stdin io.Reader, environ []string) error {
+	if mode == InputFlags {
+		return nil
+	}
+	setOnCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+	var values map[string]string
+	var err error
+	switch mode {
+	case InputJSON:
+		values, err = readJSONInput(stdin)
+		if err != nil {
+			return err
+		}
+	case InputEnv:
+		values = readEnvInput(fs, environ)
+	default:
+		return errors.New("unknown input mode '" + mode + "' (expected '" + InputJSON + "' or '" + InputEnv + "')")
+	}
+	for name, value := range values {
+		if fs.Lookup(name) == nil {
+			log.Println("Ignoring unknown input field:", name)
+			continue
+		}
+		if setOnCommandLine[name] {
+			// command line options take precedence
+			continue
+		}
+		err := fs.Set(name, value)
+		if err != nil {
+			return errors.New("invalid value of input field '" + name + "': " + err.Error())
+		}
+	}
+	return nil
+}
+
+func readJSONInput(stdin io.Reader) (map[string]string, error) {
+	decoder := json.NewDecoder(stdin)
+	// keep numbers as they are (e.g. realtime with microseconds)
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	err := decoder.Decode(&fields)
+	if err != nil {
+		return nil, errors.New("failed to decode JSON input: " + err.Error())
+	}
+	values := map[string]string{}
+	for name, field := range fields {
+		switch v := field.(type) {
+		case string:
+			values[name] = v
+		case json.Number:
+			values[name] = v.String()
+		case bool:
+			if v {
+				values[name] = "true"
+			} else {
+				values[name] = "false"
+			}
+		case nil:
+			// null is same as missing field
+		default:
+			var buf bytes.Buffer
+			json.NewEncoder(&buf).Encode(field)
+			return nil, errors.New("invalid value of input field '" + name + "': expected string, number or boolean - got: " +
+				strings.TrimSpace(buf.String()))
+		}
+	}
+	return values, nil
+}
+
+func readEnvInput(fs *flag.FlagSet, environ []string) map[string]string {
+	// lookup: environment variable -> option
+	options := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		options[EnvName(f.Name)] = f.Name
+	})
+	values := map[string]string{}
+	for _, env := range environ {
+		if strings.HasPrefix(env, EnvPrefix) == false {
+			continue
+		}
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		option, found := options[parts[0]]
+		if found == false {
+			log.Println("Ignoring unknown input variable:", parts[0])
+			continue
+		}
+		values[option] = parts[1]
+	}
+	return values
+}
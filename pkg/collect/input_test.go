@@ -0,0 +1,109 @@
+package collect
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+type testOptions struct {
+	fs        *flag.FlagSet
+	cmdLine   *string
+	exitCode  *int
+	rtb       *string
+	recall    *bool
+	recallAct *string
+}
+
+func newTestOptions() testOptions {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	return testOptions{
+		fs:        fs,
+		cmdLine:   fs.String("cmdLine", "", ""),
+		exitCode:  fs.Int("exitCode", -1, ""),
+		rtb:       fs.String("realtimeBefore", "-1", ""),
+		recall:    fs.Bool("recall", false, ""),
+		recallAct: fs.String("recall-actions", "", ""),
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	data := map[string]string{
+		"cmdLine":               "RESH_CMD_LINE",
+		"sessionId":             "RESH_SESSION_ID",
+		"gitCdupExitCode":       "RESH_GIT_CDUP_EXIT_CODE",
+		"osReleaseIdLike":       "RESH_OS_RELEASE_ID_LIKE",
+		"recall-actions":        "RESH_RECALL_ACTIONS",
+		"realtimeSessSinceBoot": "RESH_REALTIME_SESS_SINCE_BOOT",
+		"pwd":                   "RESH_PWD",
+	}
+	for option, expected := range data {
+		if name := EnvName(option); name != expected {
+			t.Error("Expected:", expected, "- got:", name)
+		}
+	}
+}
+
+func TestReadInputJSON(t *testing.T) {
+	opts := newTestOptions()
+	opts.fs.Parse([]string{"-exitCode", "3"})
+	input := `{"cmdLine": "ls -la", "exitCode": 0, "realtimeBefore": 1580000000.123456, "recall": true, "unknownField": "x"}`
+	err := ReadInput(opts.fs, InputJSON, strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatal("ReadInput() failed:", err)
+	}
+	if *opts.cmdLine != "ls -la" || *opts.rtb != "1580000000.123456" || *opts.recall != true {
+		t.Error("Unexpected values:", *opts.cmdLine, *opts.rtb, *opts.recall)
+	}
+	if *opts.exitCode != 3 {
+		t.Error("Command line option should take precedence - got:", *opts.exitCode)
+	}
+}
+
+func TestReadInputJSONInvalid(t *testing.T) {
+	inputs := []string{
+		`{"exitCode": "zero"}`,
+		`{"exitCode": 1.5}`,
+		`{"cmdLine": ["ls"]}`,
+		`not json`,
+	}
+	for _, input := range inputs {
+		opts := newTestOptions()
+		opts.fs.Parse(nil)
+		err := ReadInput(opts.fs, InputJSON, strings.NewReader(input), nil)
+		if err == nil {
+			t.Error("Expected error for input:", input)
+		}
+	}
+}
+
+func TestReadInputEnv(t *testing.T) {
+	opts := newTestOptions()
+	opts.fs.Parse(nil)
+	environ := []string{
+		"RESH_CMD_LINE=echo a=b",
+		"RESH_EXIT_CODE=1",
+		"RESH_RECALL_ACTIONS=arrow_up",
+		"RESH_UNKNOWN=x",
+		"__RESH_SESSION_ID=y",
+		"PATH=/bin",
+	}
+	err := ReadInput(opts.fs, InputEnv, nil, environ)
+	if err != nil {
+		t.Fatal("ReadInput() failed:", err)
+	}
+	if *opts.cmdLine != "echo a=b" || *opts.exitCode != 1 || *opts.recallAct != "arrow_up" {
+		t.Error("Unexpected values:", *opts.cmdLine, *opts.exitCode, *opts.recallAct)
+	}
+}
+
+func TestReadInputUnknownMode(t *testing.T) {
+	opts := newTestOptions()
+	opts.fs.Parse(nil)
+	if err := ReadInput(opts.fs, "xml", nil, nil); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+	if err := ReadInput(opts.fs, InputFlags, nil, nil); err != nil {
+		t.Error("Flags mode should not fail:", err)
+	}
+}
@@ -0,0 +1,73 @@
+package collect
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SessionInfo describes where the shell session runs (tmux, SSH)
+type SessionInfo struct {
+	// tmux ids (e.g. "$1", "@3", "%5") - empty outside of tmux
+	TmuxSession string
+	TmuxWindow  string
+	TmuxPane    string
+	// SSHClient - address of the SSH client - empty for local sessions
+	SSHClient string
+}
+
+// ReadSessionInfo reads tmux and SSH context of the session
+//		environ is a list of "NAME=value" strings (e.g. os.Environ())
+//		tmux session and window ids are read from tmux because they are not in the environment
+func ReadSessionInfo(environ []string) SessionInfo {
+	env := envMap(environ)
+	info := SessionInfo{SSHClient: ParseSSHClient(env["SSH_CONNECTION"], env["SSH_CLIENT"])}
+	if env["TMUX"] == "" || env["TMUX_PANE"] == "" {
+		return info
+	}
+	info.TmuxPane = env["TMUX_PANE"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "tmux", "display-message", "-p", "-t", info.TmuxPane,
+		"#{session_id} #{window_id} #{pane_id}").Output()
+	if err != nil {
+		log.Println("collect ERROR: failed to get tmux ids:", err)
+		return info
+	}
+	session, window, pane, ok := ParseTmuxIDs(string(out))
+	if ok == false {
+		log.Println("collect ERROR: unexpected tmux output:", string(out))
+		return info
+	}
+	info.TmuxSession = session
+	info.TmuxWindow = window
+	info.TmuxPane = pane
+	return info
+}
+
+// ParseTmuxIDs parses output of tmux "#{session_id} #{window_id} #{pane_id}" format
+func ParseTmuxIDs(out string) (string, string, string, bool) {
+	fields := strings.Fields(out)
+	if len(fields) != 3 ||
+		strings.HasPrefix(fields[0], "$") == false ||
+		strings.HasPrefix(fields[1], "@") == false ||
+		strings.HasPrefix(fields[2], "%") == false {
+		return "", "", "", false
+	}
+	return fields[0], fields[1], fields[2], true
+}
+
+// ParseSSHClient returns client address from $SSH_CONNECTION ("client_ip client_port server_ip server_port")
+//		falls back to $SSH_CLIENT ("client_ip client_port server_port")
+func ParseSSHClient(sshConnection, sshClient string) string {
+	for _, value := range []string{sshConnection, sshClient} {
+		fields := strings.Fields(value)
+		if len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	return ""
+}
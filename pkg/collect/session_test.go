@@ -0,0 +1,39 @@
+package collect
+
+import "testing"
+
+func TestParseTmuxIDs(t *testing.T) {
+	session, window, pane, ok := ParseTmuxIDs("$1 @3 %5\n")
+	if ok == false || session != "$1" || window != "@3" || pane != "%5" {
+		t.Error("Unexpected tmux ids:", session, window, pane, ok)
+	}
+	for _, out := range []string{"", "$1 @3", "1 3 5", "$1 @3 %5 x"} {
+		if _, _, _, ok := ParseTmuxIDs(out); ok {
+			t.Error("Expected invalid tmux output:", out)
+		}
+	}
+}
+
+func TestParseSSHClient(t *testing.T) {
+	data := []struct {
+		connection string
+		client     string
+		expected   string
+	}{
+		{"10.0.0.1 51234 10.0.0.2 22", "10.0.0.1 51234 22", "10.0.0.1"},
+		{"", "fe80::1 51234 22", "fe80::1"},
+		{"", "", ""},
+	}
+	for _, d := range data {
+		if client := ParseSSHClient(d.connection, d.client); client != d.expected {
+			t.Error("Expected:", d.expected, "- got:", client)
+		}
+	}
+}
+
+func TestReadSessionInfoLocal(t *testing.T) {
+	info := ReadSessionInfo([]string{"HOME=/home/user", "TERM=xterm"})
+	if info != (SessionInfo{}) {
+		t.Error("Expected empty session info:", info)
+	}
+}
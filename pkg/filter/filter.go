@@ -0,0 +1,521 @@
+package filter
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curusarn/resh/pkg/records"
+)
+
+// Filter keys
+const (
+	// KeyDir - directory (path prefix when starting with '/', '~' or '.', substring otherwise)
+	KeyDir = "dir"
+	// KeyGit - git repository (origin remote or repository directory name)
+	KeyGit = "git"
+	// KeyBranch - git branch (e.g. "branch:main")
+	KeyBranch = "branch"
+	// KeyHost - hostname
+	KeyHost = "host"
+	// KeyExit - exit code (supports comparison e.g. "exit:>0")
+	KeyExit = "exit"
+	// KeySince - commands executed in last N units of time (e.g. "since:2d")
+	KeySince = "since"
+	// KeyUntil - commands executed more than N units of time ago (e.g. "until:1w")
+	KeyUntil = "until"
+	// KeySession - session ID prefix or "current"
+	KeySession = "session"
+	// KeyDuration - duration of the command (supports comparison e.g. "dur:>30s")
+	KeyDuration = "dur"
+	// KeyCmd - command (e.g. "git" for "git commit -a")
+	KeyCmd = "cmd"
+	// KeyTag - user defined tag (e.g. "tag:favourite")
+	KeyTag = "tag"
+	// KeyExtra - extra metadata from collectors (e.g. "extra:env.TF_WORKSPACE=prod" or "extra:kubeContext")
+	KeyExtra = "extra"
+	// KeyVenv - python virtualenv or conda environment name
+	KeyVenv = "venv"
+	// KeyKube - kube context name
+	KeyKube = "kube"
+	// KeyAws - AWS profile name
+	KeyAws = "aws"
+	// KeyTmux - tmux "session", "window" or "pane" of the current session or tmux id (e.g. "tmux:window", "tmux:@3")
+	KeyTmux = "tmux"
+	// KeySSH - address of the SSH client the command was run from
+	KeySSH = "ssh"
+)
+
+// SessionCurrent is a special value for KeySession
+const SessionCurrent = "current"
+
+// SessionTree is a special value for KeySession - current session and sessions started from it (e.g. nested shells, tmux)
+const SessionTree = "tree"
+
+// special values for KeyTmux
+const (
+	TmuxSession = "session"
+	TmuxWindow  = "window"
+	TmuxPane    = "pane"
+)
+
+// Context provides information needed to evaluate relative filters (e.g. "session:current", "dir:~/proj")
+type Context struct {
+	Now       time.Time
+	SessionID string
+	Home      string
+	Pwd       string
+	// tmux ids of the current session (e.g. "$1", "@3", "%5")
+	TmuxSession string
+	TmuxWindow  string
+	TmuxPane    string
+	// SessionParents - session ID -> parent session ID (used by "session:tree")
+	SessionParents map[string]string
+	// ExtraKeys - filter key (e.g. "venv") -> names of record extras searched by the filter (e.g. "virtualenv", "conda")
+	ExtraKeys map[string][]string
+}
+
+// Filter is a single "key:value" token of the query
+type Filter struct {
+	Key    string
+	Value  string
+	Negate bool
+
+	match func(r *records.EnrichedRecord) bool
+}
+
+// Match returns true if the record passes the filter
+func (f Filter) Match(r *records.EnrichedRecord) bool {
+	return f.match(r) != f.Negate
+}
+
+// String returns the filter in the query syntax
+func (f Filter) String() string {
+	str := f.Key + ":" + f.Value
+	if f.Negate {
+		return "!" + str
+	}
+	return str
+}
+
+// Query is a parsed search query
+type Query struct {
+	// Terms - free text part of the query
+	Terms   []string
+	Filters []Filter
+}
+
+// Match returns true if the record passes all filters in the query (terms are not considered)
+func (q Query) Match(r *records.EnrichedRecord) bool {
+	for _, f := range q.Filters {
+		if f.Match(r) == false {
+			return false
+		}
+	}
+	return true
+}
+
+// HasFilter returns true if the query contains filter with given key
+func (q Query) HasFilter(key string) bool {
+	for _, f := range q.Filters {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse query string into free text terms and filters
+//		tokens are separated by whitespace
+//		tokens that look like "key:value" or "!key:value" with a known key are filters
+//		everything else is a free text term
+//		invalid filters are skipped and the first error is returned alongside the rest of the query
+func Parse(input string, ctx Context) (Query, error) {
+	var q Query
+	var firstErr error
+	for _, token := range strings.Fields(input) {
+		f, isFilter, err := parseFilter(token, ctx)
+		if isFilter == false {
+			q.Terms = append(q.Terms, token)
+			continue
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		q.Filters = append(q.Filters, f)
+	}
+	return q, firstErr
+}
+
+func parseFilter(token string, ctx Context) (Filter, bool, error) {
+	f := Filter{}
+	if strings.HasPrefix(token, "!") {
+		f.Negate = true
+		token = token[1:]
+	}
+	idx := strings.Index(token, ":")
+	if idx <= 0 {
+		return f, false, nil
+	}
+	f.Key = strings.ToLower(token[:idx])
+	f.Value = token[idx+1:]
+	var err error
+	switch f.Key {
+	case KeyDir:
+		f.match, err = dirMatcher(f.Value, ctx)
+	case KeyGit:
+		f.match, err = gitMatcher(f.Value)
+	case KeyBranch:
+		f.match, err = branchMatcher(f.Value)
+	case KeyHost:
+		f.match, err = hostMatcher(f.Value)
+	case KeyExit:
+		f.match, err = exitMatcher(f.Value)
+	case KeySince:
+		f.match, err = sinceMatcher(f.Value, ctx, true)
+	case KeyUntil:
+		f.match, err = sinceMatcher(f.Value, ctx, false)
+	case KeySession:
+		f.match, err = sessionMatcher(f.Value, ctx)
+	case KeyDuration:
+		f.match, err = durationMatcher(f.Value)
+	case KeyCmd:
+		f.match, err = cmdMatcher(f.Value)
+	case KeyTag:
+		f.match, err = tagMatcher(f.Value)
+	case KeyExtra:
+		f.match, err = extraMatcher(f.Value)
+	case KeyVenv, KeyKube, KeyAws:
+		f.match, err = extraValueMatcher(f.Value, ctx.ExtraKeys[f.Key]...)
+	case KeyTmux:
+		f.match, err = tmuxMatcher(f.Value, ctx)
+	case KeySSH:
+		f.match, err = sshMatcher(f.Value)
+	default:
+		// not a filter (e.g. URL or "key=value")
+		return f, false, nil
+	}
+	if err != nil {
+		return f, true, errors.New("invalid filter '" + token + "': " + err.Error())
+	}
+	return f, true, nil
+}
+
+func emptyValueError() error {
+	return errors.New("empty value")
+}
+
+func dirMatcher(value string, ctx Context) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	isPath := false
+	path := value
+	if path == "." || strings.HasPrefix(path, "./") {
+		path = filepath.Join(ctx.Pwd, path)
+		isPath = true
+	} else if path == "~" || strings.HasPrefix(path, "~/") {
+		path = filepath.Join(ctx.Home, path[1:])
+		isPath = true
+	} else if strings.HasPrefix(path, "/") {
+		isPath = true
+	}
+	if isPath == false {
+		return func(r *records.EnrichedRecord) bool {
+			return strings.Contains(r.Pwd, value)
+		}, nil
+	}
+	path = filepath.Clean(path)
+	return func(r *records.EnrichedRecord) bool {
+		return r.Pwd == path || strings.HasPrefix(r.Pwd, strings.TrimSuffix(path, "/")+"/")
+	}, nil
+}
+
+func gitMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	value = strings.ToLower(value)
+	return func(r *records.EnrichedRecord) bool {
+		if r.GitRealDir == "" && r.GitOriginRemote == "" {
+			return false
+		}
+		return strings.Contains(strings.ToLower(r.GitOriginRemote), value) ||
+			strings.Contains(strings.ToLower(filepath.Base(r.GitRealDir)), value)
+	}, nil
+}
+
+func branchMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	value = strings.ToLower(value)
+	return func(r *records.EnrichedRecord) bool {
+		return strings.Contains(strings.ToLower(r.GitBranch), value)
+	}, nil
+}
+
+func hostMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	value = strings.ToLower(value)
+	return func(r *records.EnrichedRecord) bool {
+		return strings.Contains(strings.ToLower(r.Host), value)
+	}, nil
+}
+
+func cmdMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	return func(r *records.EnrichedRecord) bool {
+		return r.Command == value || filepath.Base(r.Command) == value
+	}, nil
+}
+
+func tagMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	return func(r *records.EnrichedRecord) bool {
+		for _, tag := range r.Tags {
+			if tag == value {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// extraMatcher matches "name=value" exactly, "name" matches records that have the metadata
+func extraMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	parts := strings.SplitN(value, "=", 2)
+	name := parts[0]
+	if name == "" {
+		return nil, errors.New("expected name of the metadata (e.g. extra:kubeContext=prod)")
+	}
+	if len(parts) == 1 {
+		return func(r *records.EnrichedRecord) bool {
+			return r.Extra[name] != ""
+		}, nil
+	}
+	return func(r *records.EnrichedRecord) bool {
+		return r.Extra[name] == parts[1]
+	}, nil
+}
+
+// extraValueMatcher matches records where any of the metadata contains the value
+func extraValueMatcher(value string, names ...string) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	value = strings.ToLower(value)
+	return func(r *records.EnrichedRecord) bool {
+		for _, name := range names {
+			extra := r.Extra[name]
+			if extra != "" && strings.Contains(strings.ToLower(extra), value) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func sessionMatcher(value string, ctx Context) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	if value == SessionCurrent || value == SessionTree {
+		if ctx.SessionID == "" {
+			return nil, errors.New("current session is unknown")
+		}
+	}
+	if value == SessionCurrent {
+		value = ctx.SessionID
+	}
+	if value == SessionTree {
+		current := ctx.SessionID
+		parents := ctx.SessionParents
+		return func(r *records.EnrichedRecord) bool {
+			return isDescendantSession(r.SessionID, current, parents)
+		}, nil
+	}
+	return func(r *records.EnrichedRecord) bool {
+		return strings.HasPrefix(r.SessionID, value)
+	}, nil
+}
+
+// isDescendantSession returns true if the session is the ancestor or its descendant
+func isDescendantSession(id, ancestorID string, parents map[string]string) bool {
+	// guard against cycles
+	for i := 0; i <= len(parents); i++ {
+		if id == ancestorID {
+			return true
+		}
+		parent, found := parents[id]
+		if found == false || parent == "" {
+			return false
+		}
+		id = parent
+	}
+	return false
+}
+
+func tmuxMatcher(value string, ctx Context) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	var id string
+	switch value {
+	case TmuxSession:
+		id = ctx.TmuxSession
+	case TmuxWindow:
+		id = ctx.TmuxWindow
+	case TmuxPane:
+		id = ctx.TmuxPane
+	default:
+		id = value
+	}
+	if id == "" {
+		return nil, errors.New("current session is not running in tmux")
+	}
+	var field func(r *records.EnrichedRecord) string
+	switch id[0] {
+	case '$':
+		field = func(r *records.EnrichedRecord) string { return r.TmuxSession }
+	case '@':
+		field = func(r *records.EnrichedRecord) string { return r.TmuxWindow }
+	case '%':
+		field = func(r *records.EnrichedRecord) string { return r.TmuxPane }
+	default:
+		return nil, errors.New("expected session, window, pane or tmux id (e.g. $1, @3, %5)")
+	}
+	return func(r *records.EnrichedRecord) bool {
+		return field(r) == id
+	}, nil
+}
+
+func sshMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	if value == "" {
+		return nil, emptyValueError()
+	}
+	return func(r *records.EnrichedRecord) bool {
+		return r.SSHClient != "" && strings.Contains(r.SSHClient, value)
+	}, nil
+}
+
+func exitMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	op, num := splitComparison(value)
+	exitCode, err := strconv.Atoi(num)
+	if err != nil {
+		return nil, errors.New("expected exit code")
+	}
+	cmp, err := comparator(op)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *records.EnrichedRecord) bool {
+		return cmp(float64(r.ExitCode), float64(exitCode))
+	}, nil
+}
+
+func durationMatcher(value string) (func(r *records.EnrichedRecord) bool, error) {
+	op, num := splitComparison(value)
+	dur, err := ParseDuration(num)
+	if err != nil {
+		return nil, err
+	}
+	cmp, err := comparator(op)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *records.EnrichedRecord) bool {
+		return cmp(r.RealtimeDuration, dur.Seconds())
+	}, nil
+}
+
+func sinceMatcher(value string, ctx Context, since bool) (func(r *records.EnrichedRecord) bool, error) {
+	dur, err := ParseDuration(value)
+	if err != nil {
+		return nil, err
+	}
+	now := ctx.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	threshold := float64(now.Add(-dur).UnixNano()) / 1e9
+	return func(r *records.EnrichedRecord) bool {
+		if since {
+			return r.RealtimeBefore >= threshold
+		}
+		return r.RealtimeBefore < threshold
+	}, nil
+}
+
+func splitComparison(value string) (string, string) {
+	for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+		if strings.HasPrefix(value, op) {
+			return op, value[len(op):]
+		}
+	}
+	return "=", value
+}
+
+func comparator(op string) (func(a, b float64) bool, error) {
+	switch op {
+	case ">=":
+		return func(a, b float64) bool { return a >= b }, nil
+	case "<=":
+		return func(a, b float64) bool { return a <= b }, nil
+	case "!=":
+		return func(a, b float64) bool { return a != b }, nil
+	case ">":
+		return func(a, b float64) bool { return a > b }, nil
+	case "<":
+		return func(a, b float64) bool { return a < b }, nil
+	case "=":
+		return func(a, b float64) bool { return a == b }, nil
+	}
+	return nil, errors.New("unknown comparison operator '" + op + "'")
+}
+
+var durationRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(s|m|h|d|w|mo|y)$`)
+
+// ParseDuration parses durations like "30s", "5m", "2h", "2d", "1w", "3mo", "1y" and everything time.ParseDuration accepts
+func ParseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, emptyValueError()
+	}
+	if dur, err := time.ParseDuration(value); err == nil {
+		return dur, nil
+	}
+	match := durationRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, errors.New("expected duration (e.g. 30s, 5m, 2h, 2d, 1w, 3mo, 1y)")
+	}
+	num, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	day := 24 * time.Hour
+	units := map[string]time.Duration{
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  day,
+		"w":  7 * day,
+		"mo": 30 * day,
+		"y":  365 * day,
+	}
+	return time.Duration(num * float64(units[match[2]])), nil
+}
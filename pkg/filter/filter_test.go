@@ -0,0 +1,188 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/curusarn/resh/pkg/records"
+)
+
+func testRecord() records.EnrichedRecord {
+	r := records.EnrichedRecord{}
+	r.CmdLine = "make build"
+	r.Command = "make"
+	r.Pwd = "/home/user/proj/resh"
+	r.Host = "Laptop"
+	r.ExitCode = 2
+	r.SessionID = "abcdef"
+	r.GitRealDir = "/home/user/proj/resh"
+	r.GitOriginRemote = "git@github.com:curusarn/resh.git"
+	r.GitBranch = "feature/filters"
+	r.RealtimeBefore = float64(time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC).Unix())
+	r.RealtimeDuration = 45
+	r.Tags = []string{"favourite"}
+	r.Extra = map[string]string{
+		"virtualenv":       ".venv",
+		"kubeContext":      "prod-cluster",
+		"awsProfile":       "Dev",
+		"env.TF_WORKSPACE": "staging",
+	}
+	return r
+}
+
+func testContext() Context {
+	return Context{
+		Now:       time.Date(2020, 1, 11, 12, 0, 0, 0, time.UTC),
+		SessionID: "abcdef",
+		Home:      "/home/user",
+		Pwd:       "/home/user/proj",
+		ExtraKeys: map[string][]string{
+			KeyVenv: {"virtualenv", "conda"},
+			KeyKube: {"kubeContext"},
+			KeyAws:  {"awsProfile"},
+		},
+	}
+}
+
+func TestParseTermsAndFilters(t *testing.T) {
+	q, err := Parse("make dir:~/proj !exit:0 http://example.com", testContext())
+	if err != nil {
+		t.Fatal("Parse() failed:", err)
+	}
+	if len(q.Terms) != 2 || q.Terms[0] != "make" || q.Terms[1] != "http://example.com" {
+		t.Error("Parse() returned unexpected terms:", q.Terms)
+	}
+	if len(q.Filters) != 2 || q.Filters[1].String() != "!exit:0" {
+		t.Error("Parse() returned unexpected filters:", q.Filters)
+	}
+}
+
+func TestParseInvalidFilter(t *testing.T) {
+	q, err := Parse("since:2 make", testContext())
+	if err == nil {
+		t.Error("Parse() should fail for invalid duration")
+	}
+	if len(q.Terms) != 1 || len(q.Filters) != 0 {
+		t.Error("Parse() should skip only the invalid filter:", q)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rec := testRecord()
+	matching := []string{
+		"dir:~/proj",
+		"dir:.",
+		"dir:resh",
+		"git:resh",
+		"branch:filters",
+		"host:laptop",
+		"exit:2",
+		"!exit:0",
+		"exit:>0",
+		"since:2d",
+		"until:12h",
+		"session:current",
+		"dur:>30s",
+		"cmd:make",
+		"tag:favourite",
+		"extra:kubeContext",
+		"extra:env.TF_WORKSPACE=staging",
+		"venv:venv",
+		"kube:prod",
+		"aws:dev",
+		"dir:~/proj exit:2 dur:<1m",
+	}
+	for _, input := range matching {
+		q, err := Parse(input, testContext())
+		if err != nil {
+			t.Error("Parse() failed:", input, err)
+		}
+		if q.Match(&rec) == false {
+			t.Error("Match() should match:", input)
+		}
+	}
+	notMatching := []string{
+		"dir:~/pro",
+		"dir:/home/user/other",
+		"git:other",
+		"branch:main",
+		"host:desktop",
+		"exit:0",
+		"since:12h",
+		"session:xyz",
+		"dur:>1m",
+		"cmd:git",
+		"tag:deploy",
+		"extra:conda",
+		"extra:env.TF_WORKSPACE=prod",
+		"venv:conda",
+		"!kube:prod",
+		"aws:prod",
+	}
+	for _, input := range notMatching {
+		q, err := Parse(input, testContext())
+		if err != nil {
+			t.Error("Parse() failed:", input, err)
+		}
+		if q.Match(&rec) {
+			t.Error("Match() should not match:", input)
+		}
+	}
+}
+
+func TestMatchSessionTreeTmuxAndSSH(t *testing.T) {
+	rec := testRecord()
+	rec.SessionID = "nested"
+	rec.TmuxSession = "$1"
+	rec.TmuxWindow = "@3"
+	rec.TmuxPane = "%5"
+	rec.SSHClient = "10.0.0.1"
+	ctx := testContext()
+	ctx.SessionParents = map[string]string{"nested": "child", "child": "abcdef", "other": "root"}
+	ctx.TmuxSession = "$1"
+	ctx.TmuxWindow = "@3"
+	ctx.TmuxPane = "%4"
+
+	matching := []string{"session:tree", "tmux:session", "tmux:window", "tmux:@3", "!tmux:pane", "tmux:%5", "ssh:10.0.0"}
+	for _, input := range matching {
+		q, err := Parse(input, ctx)
+		if err != nil {
+			t.Error("Parse() failed:", input, err)
+		}
+		if q.Match(&rec) == false {
+			t.Error("Match() should match:", input)
+		}
+	}
+	ctx.SessionID = "other"
+	notMatching := []string{"session:tree", "tmux:$2", "ssh:192.168"}
+	for _, input := range notMatching {
+		q, err := Parse(input, ctx)
+		if err != nil {
+			t.Error("Parse() failed:", input, err)
+		}
+		if q.Match(&rec) {
+			t.Error("Match() should not match:", input)
+		}
+	}
+	if _, err := Parse("tmux:window", testContext()); err == nil {
+		t.Error("Parse() should fail for tmux filter outside of tmux")
+	}
+	if _, err := Parse("tmux:3", ctx); err == nil {
+		t.Error("Parse() should fail for invalid tmux id")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	durations := map[string]time.Duration{
+		"30s": 30 * time.Second,
+		"1h":  time.Hour,
+		"2d":  48 * time.Hour,
+		"1w":  7 * 24 * time.Hour,
+	}
+	for input, expected := range durations {
+		dur, err := ParseDuration(input)
+		if err != nil || dur != expected {
+			t.Error("ParseDuration() failed:", input, dur, err)
+		}
+	}
+}
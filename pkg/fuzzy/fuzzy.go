@@ -0,0 +1,251 @@
+package fuzzy
+
+import (
+	"unicode"
+)
+
+// scoring constants (inspired by fzf)
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	// match right after whitespace (e.g. start of a word in cmdline)
+	bonusBoundaryWhite = scoreMatch / 2
+	// match right after path delimiter
+	bonusBoundaryDelimiter = bonusBoundaryWhite - 1
+	// match right after non-word character (e.g. '-', '_', '.')
+	bonusBoundary = bonusBoundaryDelimiter - 1
+	// camelCase or letter123 transition
+	bonusCamel = bonusBoundary - 1
+	// match right after previous match
+	bonusConsecutive = -(scoreGapStart + scoreGapExtension)
+	// bonus for first character of the pattern is multiplied
+	bonusFirstCharMultiplier = 2
+)
+
+// minimal score so that we don't need to deal with overflows
+const scoreNone = -1 << 30
+
+type charClass int
+
+const (
+	charWhite charClass = iota
+	charDelimiter
+	charNonWord
+	charLower
+	charUpper
+	charLetter
+	charNumber
+)
+
+// Result of a successful match
+type Result struct {
+	Score int
+	// Positions of matched runes in the text (indexes to []rune(text)), sorted
+	Positions []int
+}
+
+func classOf(r rune) charClass {
+	switch {
+	case unicode.IsSpace(r):
+		return charWhite
+	case r == '/':
+		return charDelimiter
+	case unicode.IsLower(r):
+		return charLower
+	case unicode.IsUpper(r):
+		return charUpper
+	case unicode.IsLetter(r):
+		return charLetter
+	case unicode.IsNumber(r):
+		return charNumber
+	}
+	return charNonWord
+}
+
+func bonusFor(prev, cur charClass) int {
+	if cur == charWhite || cur == charDelimiter || cur == charNonWord {
+		return 0
+	}
+	switch prev {
+	case charWhite:
+		return bonusBoundaryWhite
+	case charDelimiter:
+		return bonusBoundaryDelimiter
+	case charNonWord:
+		return bonusBoundary
+	}
+	if prev == charLower && cur == charUpper {
+		return bonusCamel
+	}
+	if prev != charNumber && cur == charNumber {
+		return bonusCamel
+	}
+	return 0
+}
+
+// isCaseSensitive - smart case - pattern with uppercase characters is matched case sensitively
+func isCaseSensitive(pattern []rune) bool {
+	for _, r := range pattern {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match pattern against text
+//		pattern matches when all its characters are present in the text in the same order
+//		returns the best scoring alignment and false if the pattern doesn't match
+func Match(pattern, text string) (Result, bool) {
+	p := []rune(pattern)
+	t := []rune(text)
+	if len(p) == 0 {
+		return Result{}, true
+	}
+	if len(p) > len(t) {
+		return Result{}, false
+	}
+	caseSensitive := isCaseSensitive(p)
+	// normalized text used for comparison
+	tn := make([]rune, len(t))
+	for j, r := range t {
+		if caseSensitive {
+			tn[j] = r
+		} else {
+			tn[j] = unicode.ToLower(r)
+		}
+	}
+	// quick check (and bounds for the DP) - find first and last possible position of the match
+	first, last := -1, -1
+	i := 0
+	for j := 0; j < len(tn) && i < len(p); j++ {
+		if tn[j] == p[i] {
+			if i == 0 {
+				first = j
+			}
+			i++
+		}
+	}
+	if i < len(p) {
+		return Result{}, false
+	}
+	i = len(p) - 1
+	for j := len(tn) - 1; j >= first; j-- {
+		if tn[j] == p[i] {
+			if i == len(p)-1 {
+				last = j
+			}
+			i--
+			if i < 0 {
+				break
+			}
+		}
+	}
+
+	// bonus for each position in the text
+	bonus := make([]int, len(t))
+	prevClass := charWhite
+	for j, r := range t {
+		class := classOf(r)
+		bonus[j] = bonusFor(prevClass, class)
+		prevClass = class
+	}
+
+	// score[i][k] - best score when pattern[i] is matched at text[first+k]
+	// from[i][k] - position (k) where pattern[i-1] was matched
+	// chunkBonus[i][k] - bonus of the first match in the current run of consecutive matches
+	width := last - first + 1
+	score := make([][]int, len(p))
+	from := make([][]int, len(p))
+	chunkBonus := make([][]int, len(p))
+	for i := range p {
+		score[i] = make([]int, width)
+		from[i] = make([]int, width)
+		chunkBonus[i] = make([]int, width)
+		for k := range score[i] {
+			score[i][k] = scoreNone
+		}
+	}
+	for k := 0; k < width; k++ {
+		j := first + k
+		if tn[j] == p[0] {
+			score[0][k] = scoreMatch + bonus[j]*bonusFirstCharMultiplier
+			chunkBonus[0][k] = bonus[j]
+		}
+	}
+	for i := 1; i < len(p); i++ {
+		// best score of a match of pattern[i-1] followed by a gap ending at the current position
+		gapScore, gapFrom := scoreNone, -1
+		for k := 1; k < width; k++ {
+			// extend gap with the position before the previous one
+			if k >= 2 {
+				if score[i-1][k-2] > scoreNone && score[i-1][k-2]+scoreGapStart >= gapScore+scoreGapExtension {
+					gapScore, gapFrom = score[i-1][k-2]+scoreGapStart, k-2
+				} else if gapScore > scoreNone {
+					gapScore += scoreGapExtension
+				}
+			}
+			j := first + k
+			if tn[j] != p[i] {
+				continue
+			}
+			best, bestFrom, bestChunkBonus := scoreNone, -1, bonus[j]
+			if gapScore > scoreNone {
+				best, bestFrom = gapScore+bonus[j], gapFrom
+			}
+			if score[i-1][k-1] > scoreNone {
+				// consecutive matches share the bonus of the first match in the run
+				//		e.g. whole word matched from its start is as good as its first character
+				b := maxInt(chunkBonus[i-1][k-1], bonusConsecutive)
+				if bonus[j] >= bonusBoundary {
+					// new run starts at a word boundary
+					b = bonus[j]
+				}
+				if consecutive := score[i-1][k-1] + maxInt(b, bonus[j]); consecutive >= best {
+					best, bestFrom, bestChunkBonus = consecutive, k-1, b
+				}
+			}
+			if best == scoreNone {
+				continue
+			}
+			score[i][k] = best + scoreMatch
+			from[i][k] = bestFrom
+			chunkBonus[i][k] = bestChunkBonus
+		}
+	}
+
+	// pick the best end position and backtrack
+	lastP := len(p) - 1
+	bestScore, bestEnd := scoreNone, -1
+	for k := 0; k < width; k++ {
+		if score[lastP][k] > bestScore {
+			bestScore, bestEnd = score[lastP][k], k
+		}
+	}
+	if bestEnd < 0 {
+		return Result{}, false
+	}
+	positions := make([]int, len(p))
+	k := bestEnd
+	for i := len(p) - 1; i >= 0; i-- {
+		positions[i] = first + k
+		k = from[i][k]
+	}
+	return Result{Score: bestScore, Positions: positions}, true
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// PerfectScore returns score of the best possible match for given pattern
+//		useful for normalizing scores of patterns with different lengths
+func PerfectScore(pattern string) int {
+	res, _ := Match(pattern, pattern)
+	return res.Score
+}
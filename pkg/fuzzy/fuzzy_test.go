@@ -0,0 +1,68 @@
+package fuzzy
+
+import (
+	"testing"
+)
+
+func TestMatchAbbreviation(t *testing.T) {
+	res, ok := Match("gco", "git checkout master")
+	if ok == false {
+		t.Fatal("Match() didn't match abbreviation")
+	}
+	// g(it) c(heckout) - 'o' from checkout
+	if res.Positions[0] != 0 || res.Positions[1] != 4 {
+		t.Error("Match() returned unexpected positions:", res.Positions)
+	}
+	if _, ok := Match("mst", "git checkout master"); ok == false {
+		t.Error("Match() didn't match abbreviation")
+	}
+}
+
+func TestMatchNoMatch(t *testing.T) {
+	if _, ok := Match("xyz", "git checkout master"); ok {
+		t.Error("Match() matched pattern that is not in the text")
+	}
+	if _, ok := Match("tig", "git"); ok {
+		t.Error("Match() matched characters out of order")
+	}
+}
+
+func TestMatchPrefersBoundaries(t *testing.T) {
+	boundary, _ := Match("ls", "ls -la")
+	middle, _ := Match("ls", "false")
+	if boundary.Score <= middle.Score {
+		t.Error("Match() doesn't prefer word boundaries:", boundary.Score, "<=", middle.Score)
+	}
+	consecutive, _ := Match("make", "make install")
+	scattered, _ := Match("make", "mv a.k e")
+	if consecutive.Score <= scattered.Score {
+		t.Error("Match() doesn't prefer consecutive matches:", consecutive.Score, "<=", scattered.Score)
+	}
+}
+
+func TestMatchPathSegments(t *testing.T) {
+	res, ok := Match("gr", "~/go/src/resh")
+	if ok == false {
+		t.Fatal("Match() didn't match path")
+	}
+	// 'g' in go and 'r' in resh (both start of path segments) - not 'r' in src
+	if res.Positions[0] != 2 || res.Positions[1] != 9 {
+		t.Error("Match() returned unexpected positions:", res.Positions)
+	}
+}
+
+func TestMatchSmartCase(t *testing.T) {
+	if _, ok := Match("make", "MAKE"); ok == false {
+		t.Error("Match() lowercase pattern should be case insensitive")
+	}
+	if _, ok := Match("Make", "make"); ok {
+		t.Error("Match() pattern with uppercase should be case sensitive")
+	}
+}
+
+func TestPerfectScore(t *testing.T) {
+	res, _ := Match("make", "cd ~ && make")
+	if res.Score > PerfectScore("make") {
+		t.Error("PerfectScore() is lower than actual score:", PerfectScore("make"), "<", res.Score)
+	}
+}
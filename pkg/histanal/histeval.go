@@ -153,7 +153,7 @@ func (e *HistEval) Evaluate(strategy strat.IStrategy) error {
 			bar := progressbar.New(len(e.UsersRecords[i].Devices[j].Records))
 			var prevRecord records.EnrichedRecord
 			for _, record := range e.UsersRecords[i].Devices[j].Records {
-				if e.skipFailedCmds && record.ExitCode != 0 {
+				if e.skipFailedCmds && record.Failed() {
 					continue
 				}
 				candidates := strategy.GetCandidates(records.Stripped(record))
@@ -164,6 +164,10 @@ func (e *HistLoad) loadHistoryRecords(fname string) []records.EnrichedRecord {
 			}
 			record = records.Convert(&fallbackRecord)
 		}
+		if record.SessionExit {
+			// session exit records only carry session summary
+			continue
+		}
 		if e.sanitizedInput == false {
 			if record.CmdLength != 0 {
 				log.Fatal("Assert failed - 'cmdLength' is set in raw data. Maybe you want to use '--sanitized-input' option?")
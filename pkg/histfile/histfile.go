@@ -1,12 +1,18 @@
 package histfile
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"io/ioutil"
 	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/curusarn/resh/pkg/histcli"
 	"github.com/curusarn/resh/pkg/histlist"
@@ -19,20 +25,27 @@ type Histfile struct {
 	sessions      map[string]records.Record
 	historyPath   string
 
+	// guards writes to the history file
+	fileMutex sync.Mutex
+
 	recentMutex   sync.Mutex
 	recentRecords []records.Record
 
 	// NOTE: we have separate histories which only differ if there was not enough resh_history
-	//			resh_history itself is common for both bash and zsh
+	//			resh_history itself is common for bash, zsh and fish
 	bashCmdLines histlist.Histlist
 	zshCmdLines  histlist.Histlist
+	fishCmdLines histlist.Histlist
 
+	// enriched records for resh cli (guarded by recentMutex)
 	fullRecords histcli.Histcli
+	// session exit records with session summaries (guarded by recentMutex)
+	sessionExits []records.Record
 }
 
 // New creates new histfile and runs its gorutines
 func New(input chan records.Record, sessionsToDrop chan string,
-	reshHistoryPath string, bashHistoryPath string, zshHistoryPath string,
+	reshHistoryPath string, bashHistoryPath string, zshHistoryPath string, fishHistoryPath string,
 	maxInitHistSize int, minInitHistSizeKB int,
 	signals chan os.Signal, shutdownDone chan string) *Histfile {
 
@@ -41,9 +54,10 @@ func New(input chan records.Record, sessionsToDrop chan string,
 		historyPath:  reshHistoryPath,
 		bashCmdLines: histlist.New(),
 		zshCmdLines:  histlist.New(),
+		fishCmdLines: histlist.New(),
 		fullRecords:  histcli.New(),
 	}
-	go hf.loadHistory(bashHistoryPath, zshHistoryPath, maxInitHistSize, minInitHistSizeKB)
+	go hf.loadHistory(bashHistoryPath, zshHistoryPath, fishHistoryPath, maxInitHistSize, minInitHistSizeKB)
 	go hf.writer(input, signals, shutdownDone)
 	go hf.sessionGC(sessionsToDrop)
 	go hf.loadFullRecords()
@@ -53,14 +67,29 @@ func New(input chan records.Record, sessionsToDrop chan string,
 // load records from resh history, reverse, enrich and save
 func (h *Histfile) loadFullRecords() {
 	recs := records.LoadFromFile(h.historyPath, math.MaxInt32)
+	loaded := histcli.New()
 	for i := len(recs) - 1; i >= 0; i-- {
 		rec := recs[i]
-		h.fullRecords.AddRecord(rec)
+		if rec.SessionExit {
+			continue
+		}
+		loaded.AddRecord(rec)
+	}
+	var sessionExits []records.Record
+	for _, rec := range recs {
+		if rec.SessionExit {
+			sessionExits = append(sessionExits, rec)
+		}
 	}
+	h.recentMutex.Lock()
+	defer h.recentMutex.Unlock()
+	// records written while loading are kept after the loaded ones
+	h.fullRecords.List = append(loaded.List, h.fullRecords.List...)
+	h.sessionExits = append(sessionExits, h.sessionExits...)
 }
 
 // loadsHistory from resh_history and if there is not enough of it also load native shell histories
-func (h *Histfile) loadHistory(bashHistoryPath, zshHistoryPath string, maxInitHistSize, minInitHistSizeKB int) {
+func (h *Histfile) loadHistory(bashHistoryPath, zshHistoryPath, fishHistoryPath string, maxInitHistSize, minInitHistSizeKB int) {
 	h.recentMutex.Lock()
 	defer h.recentMutex.Unlock()
 	log.Println("histfile: Checking if resh_history is large enough ...")
@@ -74,32 +103,37 @@ func (h *Histfile) loadHistory(bashHistoryPath, zshHistoryPath string, maxInitHi
 	useNativeHistories := false
 	if size/1024 < minInitHistSizeKB {
 		useNativeHistories = true
-		log.Println("histfile WARN: resh_history is too small - loading native bash and zsh history ...")
+		log.Println("histfile WARN: resh_history is too small - loading native bash, zsh and fish history ...")
 		h.bashCmdLines = records.LoadCmdLinesFromBashFile(bashHistoryPath)
 		log.Println("histfile: bash history loaded - cmdLine count:", len(h.bashCmdLines.List))
 		h.zshCmdLines = records.LoadCmdLinesFromZshFile(zshHistoryPath)
 		log.Println("histfile: zsh history loaded - cmdLine count:", len(h.zshCmdLines.List))
+		h.fishCmdLines = records.LoadCmdLinesFromFishFile(fishHistoryPath)
+		log.Println("histfile: fish history loaded - cmdLine count:", len(h.fishCmdLines.List))
 		// no maxInitHistSize when using native histories
 		maxInitHistSize = math.MaxInt32
 	}
 	log.Println("histfile: Loading resh history from file ...")
 	reshCmdLines := histlist.New()
 	// NOTE: keeping this weird interface for now because we might use it in the future
-	//			when we only load bash or zsh history
+	//			when we only load bash, zsh or fish history
 	records.LoadCmdLinesFromFile(&reshCmdLines, h.historyPath, maxInitHistSize)
 	log.Println("histfile: resh history loaded - cmdLine count:", len(reshCmdLines.List))
 	if useNativeHistories == false {
 		h.bashCmdLines = reshCmdLines
 		h.zshCmdLines = histlist.Copy(reshCmdLines)
+		h.fishCmdLines = histlist.Copy(reshCmdLines)
 		return
 	}
 	h.bashCmdLines.AddHistlist(reshCmdLines)
 	log.Println("histfile: bash history + resh history - cmdLine count:", len(h.bashCmdLines.List))
 	h.zshCmdLines.AddHistlist(reshCmdLines)
 	log.Println("histfile: zsh history + resh history - cmdLine count:", len(h.zshCmdLines.List))
+	h.fishCmdLines.AddHistlist(reshCmdLines)
+	log.Println("histfile: fish history + resh history - cmdLine count:", len(h.fishCmdLines.List))
 }
 
-// sessionGC reads sessionIDs from channel and deletes them from histfile struct
+// sessionGC reads sessionIDs from channel, deletes them from histfile struct and writes session exit records
 func (h *Histfile) sessionGC(sessionsToDrop chan string) {
 	for {
 		func() {
@@ -107,17 +141,59 @@ func (h *Histfile) sessionGC(sessionsToDrop chan string) {
 			log.Println("histfile: got session to drop", session)
 			h.sessionsMutex.Lock()
 			defer h.sessionsMutex.Unlock()
-			if part1, found := h.sessions[session]; found == true {
-				log.Println("histfile: Dropping session:", session)
-				delete(h.sessions, session)
-				go writeRecord(part1, h.historyPath)
-			} else {
+			// hanging parts are stored under merge IDs (sessionID + "_" + shlvl)
+			found := false
+			for mergeID, part1 := range h.sessions {
+				if strings.HasPrefix(mergeID, session+"_") {
+					log.Println("histfile: Dropping session:", mergeID)
+					delete(h.sessions, mergeID)
+					go h.writeRecord(part1)
+					found = true
+				}
+			}
+			if found == false {
 				log.Println("histfile: No hanging parts for session:", session)
 			}
+			go h.writeSessionExit(session)
 		}()
 	}
 }
 
+// writeSessionExit writes session exit record with summary of the session
+func (h *Histfile) writeSessionExit(sessionID string) {
+	var sessionRecords []records.Record
+	func() {
+		h.recentMutex.Lock()
+		defer h.recentMutex.Unlock()
+		for _, rec := range h.fullRecords.List {
+			if rec.SessionID == sessionID {
+				sessionRecords = append(sessionRecords, rec.Record)
+			}
+		}
+	}()
+	if len(sessionRecords) == 0 {
+		log.Println("histfile: No records in session - skipping session exit record:", sessionID)
+		return
+	}
+	exit := records.NewSessionExit(sessionRecords, float64(time.Now().UnixNano())/1e9)
+	func() {
+		h.recentMutex.Lock()
+		defer h.recentMutex.Unlock()
+		h.sessionExits = append(h.sessionExits, exit)
+	}()
+	h.writeRecord(exit)
+	log.Println("histfile: Session exit record written:", sessionID, "- commands:", exit.SessionSummary.CommandCount)
+}
+
+// SessionExits returns session exit records (oldest first)
+func (h *Histfile) SessionExits() []records.Record {
+	h.recentMutex.Lock()
+	defer h.recentMutex.Unlock()
+	sessionExits := make([]records.Record, len(h.sessionExits))
+	copy(sessionExits, h.sessionExits)
+	return sessionExits
+}
+
 // writer reads records from channel, merges them and writes them to file
 func (h *Histfile) writer(input chan records.Record, signals chan os.Signal, shutdownDone chan string) {
 	for {
@@ -162,6 +238,8 @@ func (h *Histfile) writer(input chan records.Record, signals chan os.Signal, shu
 }
 
 func (h *Histfile) writeRecord(part1 records.Record) {
+	h.fileMutex.Lock()
+	defer h.fileMutex.Unlock()
 	writeRecord(part1, h.historyPath)
 }
 
@@ -179,10 +257,11 @@ func (h *Histfile) mergeAndWriteRecord(part1, part2 records.Record) {
 		cmdLine := part1.CmdLine
 		h.bashCmdLines.AddCmdLine(cmdLine)
 		h.zshCmdLines.AddCmdLine(cmdLine)
+		h.fishCmdLines.AddCmdLine(cmdLine)
 		h.fullRecords.AddRecord(part1)
 	}()
 
-	writeRecord(part1, h.historyPath)
+	h.writeRecord(part1)
 }
 
 func writeRecord(rec records.Record, outputPath string) {
@@ -212,21 +291,286 @@ func (h *Histfile) GetRecentCmdLines(shell string, limit int) histlist.Histlist
 	defer h.recentMutex.Unlock()
 	log.Println("histfile: History requested ...")
 	var hl histlist.Histlist
-	if shell == "bash" {
+	switch shell {
+	case "bash":
 		hl = histlist.Copy(h.bashCmdLines)
-		log.Println("histfile: history copied (bash) - cmdLine count:", len(hl.List))
-		return hl
-	}
-	if shell != "zsh" {
-		log.Println("histfile ERROR: Unknown shell: ", shell)
+	case "fish":
+		hl = histlist.Copy(h.fishCmdLines)
+	default:
+		if shell != "zsh" {
+			log.Println("histfile ERROR: Unknown shell: ", shell)
+		}
+		shell = "zsh"
+		hl = histlist.Copy(h.zshCmdLines)
 	}
-	hl = histlist.Copy(h.zshCmdLines)
-	log.Println("histfile: history copied (zsh) - cmdLine count:", len(hl.List))
+	log.Println("histfile: history copied ("+shell+") - cmdLine count:", len(hl.List))
 	return hl
 }
 
-// DumpRecords returns enriched records
+// DumpRecords returns a copy of enriched records
 func (h *Histfile) DumpRecords() histcli.Histcli {
-	// don't forget locks in the future
-	return h.fullRecords
+	h.recentMutex.Lock()
+	defer h.recentMutex.Unlock()
+	dump := histcli.New()
+	dump.List = make([]records.EnrichedRecord, len(h.fullRecords.List))
+	copy(dump.List, h.fullRecords.List)
+	return dump
+}
+
+// DeleteRecords removes records for which shouldDelete returns true from the history file and from memory
+//		returns number of deleted records and cmdLines that are no longer present in the history
+func (h *Histfile) DeleteRecords(shouldDelete func(cmdLine, pwd string) bool) (int, []string, error) {
+	h.fileMutex.Lock()
+	defer h.fileMutex.Unlock()
+	h.recentMutex.Lock()
+	defer h.recentMutex.Unlock()
+
+	deletedCmdLines := map[string]bool{}
+	remainingCmdLines := map[string]bool{}
+	err := rewriteHistoryLines(h.historyPath, func(line []byte, rec records.Record) ([]byte, error) {
+		if rec.SessionExit {
+			return line, nil
+		}
+		if shouldDelete(rec.CmdLine, rec.Pwd) {
+			deletedCmdLines[rec.CmdLine] = true
+			return nil, nil
+		}
+		remainingCmdLines[rec.CmdLine] = true
+		return line, nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(deletedCmdLines) == 0 {
+		return 0, nil, nil
+	}
+	deleted := 0
+	var list []records.EnrichedRecord
+	for _, rec := range h.fullRecords.List {
+		if shouldDelete(rec.CmdLine, rec.Pwd) {
+			deleted++
+			continue
+		}
+		list = append(list, rec)
+	}
+	h.fullRecords.List = list
+
+	var recentRecords []records.Record
+	for _, rec := range h.recentRecords {
+		if shouldDelete(rec.CmdLine, rec.Pwd) == false {
+			recentRecords = append(recentRecords, rec)
+		}
+	}
+	h.recentRecords = recentRecords
+
+	var removedCmdLines []string
+	for cmdLine := range deletedCmdLines {
+		if remainingCmdLines[cmdLine] {
+			continue
+		}
+		h.bashCmdLines.RemoveCmdLine(cmdLine)
+		h.zshCmdLines.RemoveCmdLine(cmdLine)
+		h.fishCmdLines.RemoveCmdLine(cmdLine)
+		removedCmdLines = append(removedCmdLines, cmdLine)
+	}
+	log.Println("histfile: deleted", deleted, "records; cmdLines removed from history:", len(removedCmdLines))
+	return deleted, removedCmdLines, nil
+}
+
+// ScrubRecords rewrites records in the history file and in memory using scrub
+//		scrub modifies the record in place and returns false if the record should be dropped
+//		returns number of changed and dropped records and cmdLines that are no longer present in the history
+func (h *Histfile) ScrubRecords(scrub func(record *records.Record) bool) (int, int, []string, error) {
+	h.fileMutex.Lock()
+	defer h.fileMutex.Unlock()
+	h.recentMutex.Lock()
+	defer h.recentMutex.Unlock()
+
+	changed, dropped := 0, 0
+	scrubbedCmdLines := map[string]bool{}
+	remainingCmdLines := map[string]bool{}
+	err := rewriteHistoryLines(h.historyPath, func(line []byte, rec records.Record) ([]byte, error) {
+		if rec.SessionExit {
+			return line, nil
+		}
+		original, err := json.Marshal(rec)
+		if err != nil {
+			return nil, err
+		}
+		cmdLine, recallLastCmdLine := rec.CmdLine, rec.RecallLastCmdLine
+		if scrub(&rec) == false {
+			dropped++
+			scrubbedCmdLines[cmdLine] = true
+			return nil, nil
+		}
+		remainingCmdLines[rec.CmdLine] = true
+		if rec.CmdLine == cmdLine && rec.RecallLastCmdLine == recallLastCmdLine {
+			return line, nil
+		}
+		changed++
+		scrubbedCmdLines[cmdLine] = true
+		return patchHistoryLine(line, original, rec)
+	})
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if changed == 0 && dropped == 0 {
+		return 0, 0, nil, nil
+	}
+	var list []records.EnrichedRecord
+	for _, enriched := range h.fullRecords.List {
+		rec := enriched.Record
+		if scrub(&rec) == false {
+			continue
+		}
+		if rec.CmdLine != enriched.CmdLine {
+			enriched = records.Enriched(rec)
+		}
+		list = append(list, enriched)
+	}
+	h.fullRecords.List = list
+
+	var recentRecords []records.Record
+	for _, rec := range h.recentRecords {
+		if scrub(&rec) {
+			recentRecords = append(recentRecords, rec)
+		}
+	}
+	h.recentRecords = recentRecords
+
+	var removedCmdLines []string
+	for cmdLine := range scrubbedCmdLines {
+		if remainingCmdLines[cmdLine] {
+			continue
+		}
+		h.bashCmdLines.RemoveCmdLine(cmdLine)
+		h.zshCmdLines.RemoveCmdLine(cmdLine)
+		h.fishCmdLines.RemoveCmdLine(cmdLine)
+		removedCmdLines = append(removedCmdLines, cmdLine)
+	}
+	log.Println("histfile: scrubbed", changed, "records; dropped", dropped, "records; cmdLines removed from history:", len(removedCmdLines))
+	return changed, dropped, removedCmdLines, nil
+}
+
+// maxHistoryLineSize - history files with longer lines are not rewritten
+const maxHistoryLineSize = 16 * 1024 * 1024
+
+// decodeHistoryLine decodes record from a line of the history file
+//		returns false for lines that are not records
+func decodeHistoryLine(line []byte) (records.Record, bool) {
+	var rec records.Record
+	if json.Unmarshal(line, &rec) == nil {
+		return rec, true
+	}
+	var fallbackRec records.FallbackRecord
+	if json.Unmarshal(line, &fallbackRec) == nil {
+		return records.Convert(&fallbackRec), true
+	}
+	return rec, false
+}
+
+// rewriteHistoryLines streams lines of the history file through rewrite and replaces the file with the result
+//		rewrite gets the original line and the decoded record and returns the new line (nil drops the line)
+//		lines that can't be decoded are kept as they are
+//		the history file is left as it is when nothing changed or when it can't be read completely
+func rewriteHistoryLines(historyPath string, rewrite func(line []byte, rec records.Record) ([]byte, error)) error {
+	file, err := os.Open(historyPath)
+	if err != nil {
+		log.Println("histfile ERROR: failed to open history file:", err)
+		return err
+	}
+	defer file.Close()
+	tmpFile, err := ioutil.TempFile(filepath.Dir(historyPath), filepath.Base(historyPath)+".tmp")
+	if err != nil {
+		log.Println("histfile ERROR: failed to create temporary history file:", err)
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	writer := bufio.NewWriter(tmpFile)
+
+	changed := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxHistoryLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		newLine := line
+		rec, ok := decodeHistoryLine(line)
+		if ok {
+			newLine, err = rewrite(line, rec)
+			if err != nil {
+				tmpFile.Close()
+				return err
+			}
+		}
+		if newLine == nil || bytes.Equal(newLine, line) == false {
+			changed = true
+		}
+		if newLine == nil {
+			continue
+		}
+		writer.Write(newLine)
+		writer.WriteByte('\n')
+	}
+	err = scanner.Err()
+	if err != nil {
+		log.Println("histfile ERROR: failed to read history file - history was not changed:", err)
+		tmpFile.Close()
+		return err
+	}
+	err = writer.Flush()
+	if err != nil {
+		log.Println("histfile ERROR: failed to write temporary history file:", err)
+		tmpFile.Close()
+		return err
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	if changed == false {
+		return nil
+	}
+	err = os.Chmod(tmpFile.Name(), 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpFile.Name(), historyPath)
+	if err != nil {
+		log.Println("histfile ERROR: failed to replace history file:", err)
+		return err
+	}
+	return nil
+}
+
+// patchHistoryLine sets fields of the line that differ between original and changed record
+//		other fields (including fields unknown to this version) are kept as they are
+func patchHistoryLine(line []byte, original []byte, changed records.Record) ([]byte, error) {
+	var fields, originalFields, changedFields map[string]json.RawMessage
+	err := json.Unmarshal(line, &fields)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(original, &originalFields)
+	if err != nil {
+		return nil, err
+	}
+	changedJSON, err := json.Marshal(changed)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(changedJSON, &changedFields)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range changedFields {
+		if bytes.Equal(value, originalFields[key]) == false {
+			fields[key] = value
+		}
+	}
+	for key := range originalFields {
+		if _, found := changedFields[key]; found == false {
+			delete(fields, key)
+		}
+	}
+	return json.Marshal(fields)
 }
@@ -0,0 +1,132 @@
+package histfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/curusarn/resh/pkg/histcli"
+	"github.com/curusarn/resh/pkg/histlist"
+	"github.com/curusarn/resh/pkg/records"
+)
+
+func newTestHistfile(t *testing.T, lines []string) (*Histfile, func()) {
+	dir, err := ioutil.TempDir("", "resh-test-histfile")
+	if err != nil {
+		t.Fatal("TempDir() failed:", err)
+	}
+	historyPath := filepath.Join(dir, "resh_history.json")
+	err = ioutil.WriteFile(historyPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal("WriteFile() failed:", err)
+	}
+	h := &Histfile{
+		historyPath:  historyPath,
+		bashCmdLines: histlist.New(),
+		zshCmdLines:  histlist.New(),
+		fishCmdLines: histlist.New(),
+		fullRecords:  histcli.New(),
+	}
+	return h, func() { os.RemoveAll(dir) }
+}
+
+func readTestHistory(t *testing.T, h *Histfile) []string {
+	content, err := ioutil.ReadFile(h.historyPath)
+	if err != nil {
+		t.Fatal("ReadFile() failed:", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// testHistoryLines - lines which have to be kept unchanged when other records are rewritten
+var testHistoryLines = []string{
+	// longer than default bufio.Scanner buffer
+	`{"cmdLine":"echo ` + strings.Repeat("x", 100*1024) + `","pwd":"/home/user","cols":"80","lines":"24"}`,
+	// not a record
+	`{"cmdLine": broken`,
+	// field unknown to this version
+	`{"cmdLine":"ls","pwd":"/home/user","cols":"80","lines":"24","fromNewerVersion":{"a":1}}`,
+	// older version of the record
+	`{"cmdLine":"make","pwd":"/home/user","cols":80,"lines":24}`,
+}
+
+func TestDeleteRecords(t *testing.T) {
+	secret := `{"cmdLine":"rm -rf /","pwd":"/","cols":"80","lines":"24"}`
+	h, cleanup := newTestHistfile(t, append([]string{secret}, testHistoryLines...))
+	defer cleanup()
+
+	deleted, removed, err := h.DeleteRecords(func(cmdLine, pwd string) bool {
+		return cmdLine == "rm -rf /"
+	})
+	if err != nil {
+		t.Fatal("DeleteRecords() failed:", err)
+	}
+	if deleted != 0 || len(removed) != 1 || removed[0] != "rm -rf /" {
+		t.Error("Unexpected DeleteRecords() result:", deleted, removed)
+	}
+	lines := readTestHistory(t, h)
+	if len(lines) != len(testHistoryLines) {
+		t.Fatal("Unexpected number of lines:", len(lines))
+	}
+	for i, line := range testHistoryLines {
+		if lines[i] != line {
+			t.Errorf("Line %d should be kept unchanged - got %.100q", i, lines[i])
+		}
+	}
+}
+
+func TestDeleteRecordsReadError(t *testing.T) {
+	tooLong := `{"cmdLine":"` + strings.Repeat("x", maxHistoryLineSize) + `"}`
+	lines := []string{`{"cmdLine":"rm -rf /","pwd":"/"}`, tooLong, `{"cmdLine":"ls","pwd":"/"}`}
+	h, cleanup := newTestHistfile(t, lines)
+	defer cleanup()
+
+	_, _, err := h.DeleteRecords(func(cmdLine, pwd string) bool {
+		return cmdLine == "rm -rf /"
+	})
+	if err == nil {
+		t.Error("DeleteRecords() should fail when the history can't be read")
+	}
+	if got := readTestHistory(t, h); len(got) != len(lines) || got[2] != lines[2] {
+		t.Error("History should not be changed when it can't be read")
+	}
+}
+
+func TestScrubRecords(t *testing.T) {
+	lines := append([]string{
+		`{"cmdLine":"mysql -phunter2","pwd":"/","cols":80,"lines":24,"fromNewerVersion":true}`,
+		`{"cmdLine":"echo hunter2 | drop","pwd":"/","cols":"80","lines":"24"}`,
+	}, testHistoryLines...)
+	h, cleanup := newTestHistfile(t, lines)
+	defer cleanup()
+
+	changed, dropped, removed, err := h.ScrubRecords(func(rec *records.Record) bool {
+		if strings.Contains(rec.CmdLine, "hunter2") == false {
+			return true
+		}
+		rec.ScrubAction = "redact"
+		rec.CmdLine = strings.Replace(rec.CmdLine, "hunter2", "[REDACTED]", -1)
+		return strings.HasSuffix(rec.CmdLine, "drop") == false
+	})
+	if err != nil {
+		t.Fatal("ScrubRecords() failed:", err)
+	}
+	if changed != 1 || dropped != 1 || len(removed) != 2 {
+		t.Error("Unexpected ScrubRecords() result:", changed, dropped, removed)
+	}
+	got := readTestHistory(t, h)
+	if len(got) != len(testHistoryLines)+1 {
+		t.Fatal("Unexpected number of lines:", len(got))
+	}
+	expected := `{"cmdLine":"mysql -p[REDACTED]","cols":80,"fromNewerVersion":true,"lines":24,"pwd":"/","scrubAction":"redact"}`
+	if got[0] != expected {
+		t.Errorf("Scrubbed line = %s - expected %s", got[0], expected)
+	}
+	for i, line := range testHistoryLines {
+		if got[i+1] != line {
+			t.Errorf("Line %d should be kept unchanged - got %.100q", i, got[i+1])
+		}
+	}
+}
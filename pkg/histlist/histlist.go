@@ -31,24 +31,8 @@ func Copy(hl Histlist) Histlist {
 // AddCmdLine to the histlist
 func (h *Histlist) AddCmdLine(cmdLine string) {
 	// lenBefore := len(h.List)
-	// lookup
-	idx, found := h.LastIndex[cmdLine]
-	if found {
-		// remove duplicate
-		if cmdLine != h.List[idx] {
-			log.Println("histlist ERROR: Adding cmdLine:", cmdLine, " != LastIndex[cmdLine]:", h.List[idx])
-		}
-		h.List = append(h.List[:idx], h.List[idx+1:]...)
-		// idx++
-		for idx < len(h.List) {
-			cmdLn := h.List[idx]
-			h.LastIndex[cmdLn]--
-			if idx != h.LastIndex[cmdLn] {
-				log.Println("histlist ERROR: Shifting LastIndex idx:", idx, " != LastIndex[cmdLn]:", h.LastIndex[cmdLn])
-			}
-			idx++
-		}
-	}
+	// remove duplicate
+	h.RemoveCmdLine(cmdLine)
 	// update last index
 	h.LastIndex[cmdLine] = len(h.List)
 	// append new cmdline
@@ -56,9 +40,71 @@ func (h *Histlist) AddCmdLine(cmdLine string) {
 	// log.Println("histlist: Added cmdLine:", cmdLine, "; history length:", lenBefore, "->", len(h.List))
 }
 
+// RemoveCmdLine from the histlist - returns false if the cmdLine was not present
+func (h *Histlist) RemoveCmdLine(cmdLine string) bool {
+	// lookup
+	idx, found := h.LastIndex[cmdLine]
+	if found == false {
+		return false
+	}
+	if cmdLine != h.List[idx] {
+		log.Println("histlist ERROR: Removing cmdLine:", cmdLine, " != LastIndex[cmdLine]:", h.List[idx])
+	}
+	h.List = append(h.List[:idx], h.List[idx+1:]...)
+	delete(h.LastIndex, cmdLine)
+	// idx++
+	for idx < len(h.List) {
+		cmdLn := h.List[idx]
+		h.LastIndex[cmdLn]--
+		if idx != h.LastIndex[cmdLn] {
+			log.Println("histlist ERROR: Shifting LastIndex idx:", idx, " != LastIndex[cmdLn]:", h.LastIndex[cmdLn])
+		}
+		idx++
+	}
+	return true
+}
+
 // AddHistlist contents of another histlist to this histlist
 func (h *Histlist) AddHistlist(h2 Histlist) {
 	for _, cmdLine := range h2.List {
 		h.AddCmdLine(cmdLine)
 	}
 }
+
+// InsertCmdLine at given index of the histlist (duplicate is removed first)
+func (h *Histlist) InsertCmdLine(idx int, cmdLine string) {
+	if oldIdx, found := h.LastIndex[cmdLine]; found {
+		h.RemoveCmdLine(cmdLine)
+		if oldIdx < idx {
+			idx--
+		}
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	if idx > len(h.List) {
+		idx = len(h.List)
+	}
+	h.List = append(h.List, "")
+	copy(h.List[idx+1:], h.List[idx:])
+	h.List[idx] = cmdLine
+	for i := idx; i < len(h.List); i++ {
+		h.LastIndex[h.List[i]] = i
+	}
+}
+
+// Trim the histlist to at most max newest cmdLines - returns removed cmdLines
+func (h *Histlist) Trim(max int) []string {
+	if len(h.List) <= max {
+		return nil
+	}
+	removed := h.List[:len(h.List)-max]
+	for _, cmdLine := range removed {
+		delete(h.LastIndex, cmdLine)
+	}
+	h.List = append([]string{}, h.List[len(h.List)-max:]...)
+	for i, cmdLine := range h.List {
+		h.LastIndex[cmdLine] = i
+	}
+	return removed
+}
@@ -1,6 +1,9 @@
 package msg
 
-import "github.com/curusarn/resh/pkg/records"
+import (
+	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/sesstree"
+)
 
 // DumpMsg struct
 type DumpMsg struct {
@@ -19,6 +22,43 @@ type InspectMsg struct {
 	Count     uint   `json:"count"`
 }
 
+// ShareHistoryMsg struct
+type ShareHistoryMsg struct {
+	// empty SessionID sets the default for new sessions
+	SessionID string `json:"sessionId"`
+	Mode      string `json:"mode"`
+}
+
+// ItemRef identifies history items by command line and directory
+type ItemRef struct {
+	CmdLine string `json:"cmdLine"`
+	Pwd     string `json:"pwd"`
+}
+
+// DeleteMsg struct
+type DeleteMsg struct {
+	Items []ItemRef `json:"items"`
+}
+
+// DeleteResponse struct
+type DeleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// ScrubResponse struct
+type ScrubResponse struct {
+	Redacted int `json:"redacted"`
+	Dropped  int `json:"dropped"`
+}
+
+// TagMsg struct
+type TagMsg struct {
+	CmdLines []string `json:"cmdLines"`
+	Tag      string   `json:"tag"`
+	// remove the tag instead of adding it
+	Remove bool `json:"remove"`
+}
+
 // MultiResponse struct
 type MultiResponse struct {
 	CmdLines []string `json:"cmdlines"`
@@ -30,3 +70,16 @@ type StatusResponse struct {
 	Version string `json:"version"`
 	Commit  string `json:"commit"`
 }
+
+// SessionsMsg struct
+type SessionsMsg struct {
+	// only return this session and its descendants (all sessions when empty)
+	SessionID string `json:"sessionId"`
+}
+
+// SessionsResponse struct
+type SessionsResponse struct {
+	Sessions []sesstree.Session `json:"sessions"`
+	// Summaries of sessions that have ended (session ID -> summary)
+	Summaries map[string]records.SessionSummary `json:"summaries,omitempty"`
+}
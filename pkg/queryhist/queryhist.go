@@ -0,0 +1,202 @@
+package queryhist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// actions that end a search
+const (
+	ActionExecute     = "execute"
+	ActionPaste       = "paste"
+	ActionCdExecute   = "cd-execute"
+	ActionCdPaste     = "cd-paste"
+	ActionEditExecute = "edit-execute"
+	ActionEditPaste   = "edit-paste"
+	ActionPrint       = "print"
+	ActionAbort       = "abort"
+)
+
+// Entry is a single search in resh-cli
+type Entry struct {
+	Query     string  `json:"query"`
+	Realtime  float64 `json:"realtime"`
+	SessionID string  `json:"sessionId"`
+	Pwd       string  `json:"pwd"`
+	Scope     string  `json:"scope"`
+	SortOrder string  `json:"sortOrder"`
+	// ResultCount - number of results shown for the query
+	ResultCount int `json:"resultCount"`
+	// Action - how the search ended
+	Action        string `json:"action"`
+	PickedCmdLine string `json:"pickedCmdLine,omitempty"`
+	PickedPwd     string `json:"pickedPwd,omitempty"`
+	// Rank - position of the picked item in the results starting from 0 (-1 when nothing was picked)
+	Rank int `json:"rank"`
+}
+
+// Picked returns true if an item was picked from the results
+func (e Entry) Picked() bool {
+	return e.Rank >= 0
+}
+
+// Append entry to the query history file
+//		the oldest entries are dropped when there are more than maxEntries entries (0 means no limit)
+func Append(path string, entry Entry, maxEntries int) error {
+	jsn, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("queryhist ERROR: failed to encode entry:", err)
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("queryhist ERROR: failed to open query history file:", err)
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(jsn, '\n'))
+	if err != nil {
+		log.Println("queryhist ERROR: failed to write query history file:", err)
+		return err
+	}
+	if maxEntries > 0 {
+		return trim(path, maxEntries)
+	}
+	return nil
+}
+
+// trim rewrites the query history file with only the last maxEntries lines
+func trim(path string, maxEntries int) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Println("queryhist ERROR: failed to read query history file:", err)
+		return err
+	}
+	lines := bytes.SplitAfter(bytes.TrimSuffix(content, []byte("\n")), []byte("\n"))
+	if len(lines) <= maxEntries {
+		return nil
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		log.Println("queryhist ERROR: failed to create temporary query history file:", err)
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(append(bytes.Join(lines[len(lines)-maxEntries:], nil), '\n'))
+	if err != nil {
+		log.Println("queryhist ERROR: failed to write temporary query history file:", err)
+		tmpFile.Close()
+		return err
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmpFile.Name(), 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpFile.Name(), path)
+	if err != nil {
+		log.Println("queryhist ERROR: failed to replace query history file:", err)
+		return err
+	}
+	return nil
+}
+
+// Load entries from the query history file (oldest first)
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read entries in JSON lines format - invalid lines are skipped
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := Entry{}
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			log.Println("queryhist ERROR: failed to decode line:", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Queries returns distinct non-empty queries (newest first)
+func Queries(entries []Entry) []string {
+	var queries []string
+	seen := map[string]bool{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		query := entries[i].Query
+		if query == "" || seen[query] {
+			continue
+		}
+		seen[query] = true
+		queries = append(queries, query)
+	}
+	return queries
+}
+
+// Stats summarizes ranking quality
+type Stats struct {
+	Searches int `json:"searches"`
+	Picked   int `json:"picked"`
+	Aborted  int `json:"aborted"`
+	// MeanReciprocalRank - mean of 1/(rank+1) over picked searches
+	MeanReciprocalRank float64 `json:"meanReciprocalRank"`
+	// Top1, Top3, Top10 - number of picked items that were in the top N results
+	Top1  int `json:"top1"`
+	Top3  int `json:"top3"`
+	Top10 int `json:"top10"`
+	// RankCounts - lookup: rank -> number of picked items with the rank
+	RankCounts map[int]int `json:"rankCounts"`
+}
+
+// ComputeStats of the entries
+func ComputeStats(entries []Entry) Stats {
+	stats := Stats{RankCounts: map[int]int{}}
+	var sumReciprocalRank float64
+	for _, entry := range entries {
+		stats.Searches++
+		if entry.Action == ActionAbort {
+			stats.Aborted++
+		}
+		if entry.Picked() == false {
+			continue
+		}
+		stats.Picked++
+		stats.RankCounts[entry.Rank]++
+		sumReciprocalRank += 1 / float64(entry.Rank+1)
+		if entry.Rank < 1 {
+			stats.Top1++
+		}
+		if entry.Rank < 3 {
+			stats.Top3++
+		}
+		if entry.Rank < 10 {
+			stats.Top10++
+		}
+	}
+	if stats.Picked > 0 {
+		stats.MeanReciprocalRank = sumReciprocalRank / float64(stats.Picked)
+	}
+	return stats
+}
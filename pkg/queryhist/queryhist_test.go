@@ -0,0 +1,108 @@
+package queryhist
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queryhist")
+	if err != nil {
+		t.Fatal("TempDir() failed:", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queries.json")
+	entries, err := Load(path)
+	if err != nil || len(entries) != 0 {
+		t.Fatal("Load() of missing file should return no entries - got:", entries, err)
+	}
+	for _, e := range []Entry{
+		{Query: "git", Action: ActionExecute, PickedCmdLine: "git status", Rank: 0},
+		{Query: "make", Action: ActionAbort, Rank: -1},
+	} {
+		err := Append(path, e, 0)
+		if err != nil {
+			t.Fatal("Append() failed:", err)
+		}
+	}
+	entries, err = Load(path)
+	if err != nil {
+		t.Fatal("Load() failed:", err)
+	}
+	if len(entries) != 2 || entries[0].PickedCmdLine != "git status" || entries[1].Picked() {
+		t.Error("Unexpected entries:", entries)
+	}
+}
+
+func TestReadSkipsInvalidLines(t *testing.T) {
+	input := `{"query":"a","rank":0}
+not json
+{"query":"b","rank":-1}
+`
+	entries, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatal("Read() failed:", err)
+	}
+	if len(entries) != 2 {
+		t.Error("Expected 2 entries - got:", entries)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	entries := []Entry{{Query: "a"}, {Query: "b"}, {Query: ""}, {Query: "a"}, {Query: "c"}}
+	queries := Queries(entries)
+	expected := []string{"c", "a", "b"}
+	if strings.Join(queries, ",") != strings.Join(expected, ",") {
+		t.Error("Expected:", expected, "- got:", queries)
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	entries := []Entry{
+		{Action: ActionExecute, Rank: 0},
+		{Action: ActionPaste, Rank: 1},
+		{Action: ActionExecute, Rank: 11},
+		{Action: ActionAbort, Rank: -1},
+		{Action: ActionPrint, Rank: -1},
+	}
+	stats := ComputeStats(entries)
+	if stats.Searches != 5 || stats.Picked != 3 || stats.Aborted != 1 {
+		t.Error("Unexpected counts:", stats)
+	}
+	if stats.Top1 != 1 || stats.Top3 != 2 || stats.Top10 != 2 {
+		t.Error("Unexpected top N counts:", stats)
+	}
+	expectedMRR := (1 + 1.0/2 + 1.0/12) / 3
+	if math.Abs(stats.MeanReciprocalRank-expectedMRR) > 1e-9 {
+		t.Error("Expected MRR:", expectedMRR, "- got:", stats.MeanReciprocalRank)
+	}
+	if stats.RankCounts[11] != 1 {
+		t.Error("Unexpected rank counts:", stats.RankCounts)
+	}
+}
+
+func TestAppendDropsOldestEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queryhist")
+	if err != nil {
+		t.Fatal("TempDir() failed:", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queries.json")
+	for _, query := range []string{"a", "b", "c", "d", "e"} {
+		err := Append(path, Entry{Query: query, Action: ActionAbort, Rank: -1}, 3)
+		if err != nil {
+			t.Fatal("Append() failed:", err)
+		}
+	}
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatal("Load() failed:", err)
+	}
+	if len(entries) != 3 || entries[0].Query != "c" || entries[2].Query != "e" {
+		t.Error("Only the last 3 entries should be kept - got:", entries)
+	}
+}
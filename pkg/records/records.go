@@ -7,6 +7,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -22,6 +23,8 @@ type BaseRecord struct {
 	Shell     string `json:"shell"`
 	Uname     string `json:"uname"`
 	SessionID string `json:"sessionId"`
+	// exit codes of all commands of the pipeline (only for pipelines with multiple commands)
+	PipeStatus []int `json:"pipeStatus,omitempty"`
 
 	// posix
 	Home  string `json:"home"`
@@ -45,6 +48,13 @@ type BaseRecord struct {
 	Machtype     string `json:"machtype"`
 	Shlvl        int    `json:"shlvl"`
 
+	// session tree - sent on session init and copied to records of the session by the daemon
+	ParentSessionID string `json:"parentSessionId,omitempty"`
+	TmuxSession     string `json:"tmuxSession,omitempty"`
+	TmuxWindow      string `json:"tmuxWindow,omitempty"`
+	TmuxPane        string `json:"tmuxPane,omitempty"`
+	SSHClient       string `json:"sshClient,omitempty"`
+
 	// before after
 	TimezoneBefore string `json:"timezoneBefore"`
 	TimezoneAfter  string `json:"timezoneAfter"`
@@ -67,12 +77,22 @@ type BaseRecord struct {
 	GitOriginRemoteAfter string `json:"gitOriginRemoteAfter"`
 	MachineID            string `json:"machineId"`
 
+	GitBranch      string            `json:"gitBranch,omitempty"`
+	GitCommit      string            `json:"gitCommit,omitempty"`
+	GitDirty       bool              `json:"gitDirty,omitempty"`
+	GitRemotes     map[string]string `json:"gitRemotes,omitempty"`
+	GitBranchAfter string            `json:"gitBranchAfter,omitempty"`
+	GitCommitAfter string            `json:"gitCommitAfter,omitempty"`
+
 	OsReleaseID         string `json:"osReleaseId"`
 	OsReleaseVersionID  string `json:"osReleaseVersionId"`
 	OsReleaseIDLike     string `json:"osReleaseIdLike"`
 	OsReleaseName       string `json:"osReleaseName"`
 	OsReleasePrettyName string `json:"osReleasePrettyName"`
 
+	// metadata from collectors (e.g. virtualenv, kube context, allowlisted env vars)
+	Extra map[string]string `json:"extra,omitempty"`
+
 	ReshUUID     string `json:"reshUuid"`
 	ReshVersion  string `json:"reshVersion"`
 	ReshRevision string `json:"reshRevision"`
@@ -82,6 +102,8 @@ type BaseRecord struct {
 	PartsMerged bool `json:"partsMerged"`
 	// special flag -> not an actual record but an session end
 	SessionExit bool `json:"sessionExit,omitempty"`
+	// only set in session exit records
+	SessionSummary *SessionSummary `json:"sessionSummary,omitempty"`
 
 	// recall metadata
 	Recalled          bool     `json:"recalled"`
@@ -94,9 +116,27 @@ type BaseRecord struct {
 	// recall command
 	RecallPrefix string `json:"recallPrefix,omitempty"`
 
+	// added by scrubber - action taken and names of detectors that found a secret in the record
+	ScrubAction    string   `json:"scrubAction,omitempty"`
+	ScrubDetectors []string `json:"scrubDetectors,omitempty"`
+
 	// added by sanitizatizer
 	Sanitized bool `json:"sanitized,omitempty"`
 	CmdLength int  `json:"cmdLength,omitempty"`
+	// SanitizerHash - hash algorithm used to sanitize the record (hmac-sha256 or sha1)
+	SanitizerHash string `json:"sanitizerHash,omitempty"`
+}
+
+// SessionSummary - summary of the session saved in the session exit record
+type SessionSummary struct {
+	RealtimeStart float64 `json:"realtimeStart"`
+	RealtimeEnd   float64 `json:"realtimeEnd"`
+	CommandCount  int     `json:"commandCount"`
+	FailedCount   int     `json:"failedCount"`
+	// Dirs - directories visited during the session in order of the first visit
+	Dirs []string `json:"dirs"`
+	// CommandsDuration - total duration of all commands in seconds
+	CommandsDuration float64 `json:"commandsDuration"`
 }
 
 // Record representing single executed command with its metadata
@@ -119,6 +159,8 @@ type EnrichedRecord struct {
 	LastRecordOfSession bool     `json:"lastRecordOfSession"`
 	DebugThisRecord     bool     `json:"debugThisRecord"`
 	Errors              []string `json:"errors"`
+	// user defined tags of the command line (e.g. favourite)
+	Tags []string `json:"tags,omitempty"`
 	// SeqSessionID uint64 `json:"seqSessionId,omitempty"`
 }
 
@@ -137,6 +179,10 @@ type SlimRecord struct {
 	RecallHistno int    `json:"recallHistno,omitempty"`
 	RecallPrefix string `json:"recallPrefix,omitempty"`
 
+	// used to init session history when the daemon doesn't know the session
+	Shell      string `json:"shell,omitempty"`
+	SessionPID int    `json:"sessionPid,omitempty"`
+
 	// extra recall - we might use these in the future
 	// Pwd string `json:"pwd"`
 	// RealPwd string `json:"realPwd"`
@@ -202,12 +248,15 @@ func (r *Record) Merge(r2 Record) error {
 	}
 	// r.RealtimeBefore != r2.RealtimeBefore - can't be used because of bash-preexec runs when it's not supposed to
 	r.ExitCode = r2.ExitCode
+	r.PipeStatus = r2.PipeStatus
 	r.PwdAfter = r2.PwdAfter
 	r.RealPwdAfter = r2.RealPwdAfter
 	r.GitDirAfter = r2.GitDirAfter
 	r.GitRealDirAfter = r2.GitRealDirAfter
 	r.RealtimeAfter = r2.RealtimeAfter
 	r.GitOriginRemoteAfter = r2.GitOriginRemoteAfter
+	r.GitBranchAfter = r2.GitBranchAfter
+	r.GitCommitAfter = r2.GitCommitAfter
 	r.TimezoneAfter = r2.TimezoneAfter
 	r.RealtimeAfterLocal = r2.RealtimeAfterLocal
 	r.RealtimeDuration = r2.RealtimeDuration
@@ -217,6 +266,96 @@ func (r *Record) Merge(r2 Record) error {
 	return nil
 }
 
+// NewSessionExit creates session exit record summarizing records of the session
+//		session metadata (host, shell, ...) is taken from the last record
+//		realtimeEnd is the time when the session end was detected
+func NewSessionExit(sessionRecords []Record, realtimeEnd float64) Record {
+	recs := make([]Record, len(sessionRecords))
+	copy(recs, sessionRecords)
+	sort.SliceStable(recs, func(i, j int) bool {
+		return recs[i].RealtimeBefore < recs[j].RealtimeBefore
+	})
+
+	summary := SessionSummary{RealtimeEnd: realtimeEnd, Dirs: []string{}}
+	dirs := map[string]bool{}
+	addDir := func(dir string) {
+		if dir != "" && dirs[dir] == false {
+			dirs[dir] = true
+			summary.Dirs = append(summary.Dirs, dir)
+		}
+	}
+	for _, rec := range recs {
+		start := rec.RealtimeBefore
+		if rec.RealtimeSinceSessionStart > 0 {
+			start -= rec.RealtimeSinceSessionStart
+		}
+		if summary.RealtimeStart == 0 || start < summary.RealtimeStart {
+			summary.RealtimeStart = start
+		}
+		summary.CommandCount++
+		if rec.Failed() {
+			summary.FailedCount++
+		}
+		if rec.RealtimeDuration > 0 {
+			summary.CommandsDuration += rec.RealtimeDuration
+		}
+		addDir(rec.Pwd)
+		addDir(rec.PwdAfter)
+	}
+
+	exit := Record{BaseRecord: BaseRecord{
+		SessionExit:    true,
+		SessionSummary: &summary,
+		RealtimeBefore: realtimeEnd,
+	}}
+	if len(recs) > 0 {
+		last := recs[len(recs)-1]
+		exit.SessionID = last.SessionID
+		exit.SessionPID = last.SessionPID
+		exit.Shell = last.Shell
+		exit.Shlvl = last.Shlvl
+		exit.Uname = last.Uname
+		exit.Home = last.Home
+		exit.Login = last.Login
+		exit.Host = last.Host
+		exit.MachineID = last.MachineID
+		exit.ParentSessionID = last.ParentSessionID
+		exit.TmuxSession = last.TmuxSession
+		exit.TmuxWindow = last.TmuxWindow
+		exit.TmuxPane = last.TmuxPane
+		exit.SSHClient = last.SSHClient
+		exit.ReshUUID = last.ReshUUID
+		exit.ReshVersion = last.ReshVersion
+		exit.ReshRevision = last.ReshRevision
+	}
+	return exit
+}
+
+// exit code of a command killed by SIGPIPE
+const exitCodeSigpipe = 141
+
+// PipelineExitCode returns exit code that takes all commands of the pipeline into account
+//		it's the exit code of the last failed command (same as with "set -o pipefail")
+//		commands killed by SIGPIPE are not considered failed unless they are last (e.g. "yes | head")
+func (r *BaseRecord) PipelineExitCode() int {
+	if r.ExitCode != 0 {
+		return r.ExitCode
+	}
+	for i := len(r.PipeStatus) - 1; i >= 0; i-- {
+		status := r.PipeStatus[i]
+		if status == 0 || (status == exitCodeSigpipe && i != len(r.PipeStatus)-1) {
+			continue
+		}
+		return status
+	}
+	return 0
+}
+
+// Failed returns true if the command or any command of its pipeline failed
+func (r *BaseRecord) Failed() bool {
+	return r.PipelineExitCode() != 0
+}
+
 // Validate - returns error if the record is invalid
 func (r *Record) Validate() error {
 	if r.CmdLine == "" {
@@ -277,6 +416,7 @@ func (r *EnrichedRecord) SetCmdLine(cmdLine string) {
 	r.CmdLine = cmdLine
 	r.CmdLength = len(cmdLine)
 	r.ExitCode = 0
+	r.PipeStatus = nil
 	var err error
 	r.Command, r.FirstWord, err = GetCommandAndFirstWord(cmdLine)
 	if err != nil {
@@ -336,7 +476,9 @@ type DistParams struct {
 	Pwd       float64
 	RealPwd   float64
 	Git       float64
+	GitBranch float64
 	Time      float64
+	Extra     float64
 }
 
 // DistanceTo another record
@@ -348,8 +490,9 @@ func (r *EnrichedRecord) DistanceTo(r2 EnrichedRecord, p DistParams) float64 {
 	// CmdLine
 
 	// exit code
-	if r.ExitCode != r2.ExitCode {
-		if r.ExitCode == 0 || r2.ExitCode == 0 {
+	exitCode, exitCode2 := r.PipelineExitCode(), r2.PipelineExitCode()
+	if exitCode != exitCode2 {
+		if exitCode == 0 || exitCode2 == 0 {
 			// one success + one error -> 1
 			dist += 1 * p.ExitCode
 		} else {
@@ -406,6 +549,9 @@ func (r *EnrichedRecord) DistanceTo(r2 EnrichedRecord, p DistParams) float64 {
 	if r.GitOriginRemote != r2.GitOriginRemote {
 		dist += 1 * p.Git
 	}
+	if r.GitBranch != r2.GitBranch {
+		dist += 1 * p.GitBranch
+	}
 
 	// time
 	// this can actually get negative for differences of less than one second which is fine
@@ -444,6 +590,9 @@ func (r *EnrichedRecord) DistanceTo(r2 EnrichedRecord, p DistParams) float64 {
 	// Lang
 	// LcAll
 
+	// extra metadata
+	dist += extraDistance(r.Extra, r2.Extra) * p.Extra
+
 	// meta
 	// ReshUUID
 	// ReshVersion
@@ -456,6 +605,27 @@ func (r *EnrichedRecord) DistanceTo(r2 EnrichedRecord, p DistParams) float64 {
 	return dist
 }
 
+// extraDistance returns fraction of extra metadata keys with different values (from 0 to 1)
+func extraDistance(extra1, extra2 map[string]string) float64 {
+	keys := map[string]bool{}
+	for key := range extra1 {
+		keys[key] = true
+	}
+	for key := range extra2 {
+		keys[key] = true
+	}
+	if len(keys) == 0 {
+		return 0
+	}
+	different := 0
+	for key := range keys {
+		if extra1[key] != extra2[key] {
+			different++
+		}
+	}
+	return float64(different) / float64(len(keys))
+}
+
 // LoadCmdLinesFromFile loads cmdlines from file
 func LoadCmdLinesFromFile(hl *histlist.Histlist, fname string, limit int) {
 	recs := LoadFromFile(fname, limit*3) // assume that at least 1/3 of commands is unique
@@ -463,6 +633,9 @@ func LoadCmdLinesFromFile(hl *histlist.Histlist, fname string, limit int) {
 	var cmdLines []string
 	cmdLinesSet := map[string]bool{}
 	for i := len(recs) - 1; i >= 0; i-- {
+		if recs[i].SessionExit {
+			continue
+		}
 		cmdLine := recs[i].CmdLine
 		if cmdLinesSet[cmdLine] {
 			continue
@@ -580,3 +753,65 @@ func LoadCmdLinesFromBashFile(fname string) histlist.Histlist {
 	}
 	return hl
 }
+
+// LoadCmdLinesFromFishFile loads cmdlines from fish history file
+func LoadCmdLinesFromFishFile(fname string) histlist.Histlist {
+	hl := histlist.New()
+	file, err := os.Open(fname)
+	if err != nil {
+		log.Println("Open() fish history file error:", err)
+		log.Println("WARN: Skipping reading fish history!")
+		return hl
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// fish format (yaml-like)
+		// - cmd: make install
+		//   when: 1576270617
+		//   paths:
+		//     - install
+		if strings.HasPrefix(line, "- cmd: ") == false {
+			// when, paths or other metadata => skip
+			continue
+		}
+		cmd := unescapeFishHistory(strings.TrimPrefix(line, "- cmd: "))
+		if len(cmd) == 0 {
+			// skip empty
+			continue
+		}
+		hl.AddCmdLine(cmd)
+	}
+	return hl
+}
+
+// unescapeFishHistory decodes newlines ("\n") and backslashes ("\\") escaped by fish
+func unescapeFishHistory(str string) string {
+	var res strings.Builder
+	escaped := false
+	for _, r := range str {
+		if escaped {
+			if r == 'n' {
+				res.WriteRune('\n')
+			} else {
+				if r != '\\' {
+					res.WriteRune('\\')
+				}
+				res.WriteRune(r)
+			}
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		res.WriteRune(r)
+	}
+	if escaped {
+		res.WriteRune('\\')
+	}
+	return res.String()
+}
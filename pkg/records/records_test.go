@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -130,7 +131,9 @@ func TestDistanceTo(t *testing.T) {
 		Pwd:       1,
 		RealPwd:   1,
 		Git:       1,
+		GitBranch: 1,
 		Time:      1,
+		Extra:     1,
 	}
 	paramsZero := DistParams{}
 	var prevRec EnrichedRecord
@@ -150,3 +153,88 @@ func TestDistanceTo(t *testing.T) {
 		prevRec = rec
 	}
 }
+
+func TestDistanceToGitBranch(t *testing.T) {
+	rec := EnrichedRecord{}
+	rec.GitBranch = "main"
+	other := EnrichedRecord{}
+	other.GitBranch = "feature"
+	if dist := rec.DistanceTo(other, DistParams{Git: 1}); dist != 0 {
+		t.Error("DistanceTo() should ignore git branch when GitBranch weight is not set - got:", dist)
+	}
+	if dist := rec.DistanceTo(other, DistParams{GitBranch: 2}); dist != 2 {
+		t.Error("DistanceTo() should use GitBranch weight for different branches - got:", dist)
+	}
+}
+
+func TestPipelineExitCode(t *testing.T) {
+	data := []struct {
+		exitCode   int
+		pipeStatus []int
+		expected   int
+	}{
+		{0, nil, 0},
+		{2, nil, 2},
+		{0, []int{0, 0}, 0},
+		{0, []int{2, 0}, 2},
+		{0, []int{1, 2, 0}, 2},
+		{1, []int{2, 1}, 1},
+		{0, []int{141, 0}, 0},
+		{141, []int{0, 141}, 141},
+	}
+	for _, d := range data {
+		r := BaseRecord{ExitCode: d.exitCode, PipeStatus: d.pipeStatus}
+		if code := r.PipelineExitCode(); code != d.expected {
+			t.Error("Expected:", d.expected, "- got:", code, "- for:", d.exitCode, d.pipeStatus)
+		}
+		if r.Failed() != (d.expected != 0) {
+			t.Error("Failed() doesn't match PipelineExitCode() for:", d.exitCode, d.pipeStatus)
+		}
+	}
+}
+
+func TestNewSessionExit(t *testing.T) {
+	recs := []Record{
+		{BaseRecord: BaseRecord{SessionID: "s1", Host: "old", Pwd: "/a", PwdAfter: "/b", ExitCode: 1,
+			RealtimeBefore: 110, RealtimeSinceSessionStart: 10, RealtimeDuration: 2}},
+		{BaseRecord: BaseRecord{SessionID: "s1", Host: "new", Pwd: "/c", PwdAfter: "/c", PipeStatus: []int{1, 0},
+			RealtimeBefore: 130, RealtimeSinceSessionStart: 30, RealtimeDuration: 3.5}},
+		{BaseRecord: BaseRecord{SessionID: "s1", Host: "mid", Pwd: "/b", PwdAfter: "/a",
+			RealtimeBefore: 120, RealtimeSinceSessionStart: 20, RealtimeDuration: 0.5}},
+	}
+	exit := NewSessionExit(recs, 200)
+	if exit.SessionExit == false || exit.SessionID != "s1" || exit.Host != "new" || exit.RealtimeBefore != 200 {
+		t.Error("Unexpected session exit record:", exit.BaseRecord)
+	}
+	summary := exit.SessionSummary
+	if summary == nil {
+		t.Fatal("Session exit record should have summary")
+	}
+	if summary.RealtimeStart != 100 || summary.RealtimeEnd != 200 || summary.CommandCount != 3 ||
+		summary.FailedCount != 2 || summary.CommandsDuration != 6 {
+		t.Error("Unexpected summary:", *summary)
+	}
+	if strings.Join(summary.Dirs, " ") != "/a /b /c" {
+		t.Error("Unexpected dirs:", summary.Dirs)
+	}
+	if recs[1].Host != "new" {
+		t.Error("NewSessionExit() should not reorder the records")
+	}
+}
+
+func TestLoadCmdLinesFromFishFile(t *testing.T) {
+	hl := LoadCmdLinesFromFishFile("testdata/fish_history")
+	expected := []string{
+		`echo "a\b"`,
+		"for f in *\n    echo $f\nend",
+		"make install",
+	}
+	if len(hl.List) != len(expected) {
+		t.Fatal("Unexpected cmdLines:", hl.List)
+	}
+	for i, cmdLine := range expected {
+		if hl.List[i] != cmdLine {
+			t.Error("Expected:", cmdLine, "- got:", hl.List[i])
+		}
+	}
+}
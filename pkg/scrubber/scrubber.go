@@ -0,0 +1,254 @@
+package scrubber
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/curusarn/resh/pkg/cfg"
+	"github.com/curusarn/resh/pkg/records"
+)
+
+// Actions taken when a secret is detected in the record
+const (
+	// ActionRedact - replace secrets with Redacted and save the record
+	ActionRedact = "redact"
+	// ActionDrop - don't save the record at all
+	ActionDrop = "drop"
+)
+
+// Redacted replaces detected secrets
+const Redacted = "[REDACTED]"
+
+// DetectorEntropy - name of the entropy based detector
+const DetectorEntropy = "entropy"
+
+// detector finds secrets using a regexp
+//		secret is the first capture group (if there is one) or the whole match
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// built-in detectors - name -> regexp
+var builtinDetectors = []struct {
+	name    string
+	pattern string
+}{
+	{"aws-access-key", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{"github-token", `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`},
+	{"jwt", `\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+	{"url-password", `\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`},
+	{"auth-header", `(?i)\bauthorization:\s*(?:bearer|basic|token)\s+([^\s"']+)`},
+	{"password-flag", `(?:\b(?:mysql|mysqldump|mysqladmin|mariadb)\b[^|;&]*\s-p([^\s"']+)|\bsshpass\s+-p\s*("[^"]*"|'[^']*'|[^\s"']+)|--password=("[^"]*"|'[^']*'|[^\s"']+))`},
+	{"secret-assignment", `(?i)\b[A-Z0-9_]*(?:SECRET|TOKEN|PASSWORD|PASSWD|API_?KEY)[A-Z0-9_]*=("[^"]*"|'[^']*'|[^\s"']+)`},
+}
+
+// candidates for the entropy detector (base64, base64url and similar alphabets)
+var entropyTokenRegexp = regexp.MustCompile(`[A-Za-z0-9+/_-]+=*`)
+
+// Scrubber detects and redacts secrets in records
+type Scrubber struct {
+	action           string
+	detectors        []detector
+	entropyThreshold float64
+	entropyMinLength int
+}
+
+// New creates scrubber from config
+func New(config cfg.ScrubConfig) (*Scrubber, error) {
+	s := Scrubber{
+		action:           config.Action,
+		entropyThreshold: config.EntropyThreshold,
+		entropyMinLength: config.EntropyMinLength,
+	}
+	if s.action == "" {
+		s.action = ActionRedact
+	}
+	if s.action != ActionRedact && s.action != ActionDrop {
+		return nil, errors.New("unknown scrub action: '" + config.Action + "' (expected '" + ActionRedact + "' or '" + ActionDrop + "')")
+	}
+	if s.entropyMinLength <= 0 {
+		s.entropyMinLength = 20
+	}
+	disabled := map[string]bool{}
+	for _, name := range config.DisabledDetectors {
+		disabled[name] = true
+	}
+	if disabled[DetectorEntropy] {
+		s.entropyThreshold = 0
+	}
+	for _, d := range builtinDetectors {
+		if disabled[d.name] {
+			continue
+		}
+		s.detectors = append(s.detectors, detector{name: d.name, pattern: regexp.MustCompile(d.pattern)})
+	}
+	// sort custom patterns to keep the order of detectors stable
+	var names []string
+	for name := range config.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pattern, err := regexp.Compile(config.Patterns[name])
+		if err != nil {
+			return nil, errors.New("invalid scrub pattern '" + name + "': " + err.Error())
+		}
+		s.detectors = append(s.detectors, detector{name: name, pattern: pattern})
+	}
+	return &s, nil
+}
+
+// Action returns action taken when a secret is detected
+func (s *Scrubber) Action() string {
+	return s.action
+}
+
+// ScrubCmdLine replaces secrets in cmdLine with Redacted
+//		returns scrubbed cmdLine and names of detectors that found a secret (empty if there were no secrets)
+func (s *Scrubber) ScrubCmdLine(cmdLine string) (string, []string) {
+	type span struct {
+		start, end int
+	}
+	var spans []span
+	var detected []string
+	add := func(start, end int) bool {
+		if start < 0 || start == end || cmdLine[start:end] == Redacted {
+			return false
+		}
+		spans = append(spans, span{start, end})
+		return true
+	}
+	for _, d := range s.detectors {
+		found := false
+		for _, match := range d.pattern.FindAllStringSubmatchIndex(cmdLine, -1) {
+			if len(match) == 2 {
+				found = add(match[0], match[1]) || found
+				continue
+			}
+			// use the first capture group that matched
+			for i := 2; i+1 < len(match); i += 2 {
+				if match[i] >= 0 {
+					found = add(match[i], match[i+1]) || found
+					break
+				}
+			}
+		}
+		if found {
+			detected = append(detected, d.name)
+		}
+	}
+	if s.entropyThreshold > 0 {
+		found := false
+		for _, match := range entropyTokenRegexp.FindAllStringIndex(cmdLine, -1) {
+			if s.isHighEntropy(cmdLine[match[0]:match[1]]) {
+				found = add(match[0], match[1]) || found
+			}
+		}
+		if found {
+			detected = append(detected, DetectorEntropy)
+		}
+	}
+	if len(spans) == 0 {
+		return cmdLine, nil
+	}
+
+	// merge overlapping spans and replace them
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	var sb strings.Builder
+	pos := 0
+	for i := 0; i < len(spans); i++ {
+		start, end := spans[i].start, spans[i].end
+		for i+1 < len(spans) && spans[i+1].start < end {
+			i++
+			if spans[i].end > end {
+				end = spans[i].end
+			}
+		}
+		sb.WriteString(cmdLine[pos:start])
+		sb.WriteString(Redacted)
+		pos = end
+	}
+	sb.WriteString(cmdLine[pos:])
+	return sb.String(), detected
+}
+
+// Scrub redacts secrets in the record and notes the action taken and detectors in the record
+//		returns false if the record should be dropped (cmdLines are left as they are in that case)
+func (s *Scrubber) Scrub(record *records.Record) bool {
+	cmdLine, detected := s.ScrubCmdLine(record.CmdLine)
+	recallLastCmdLine, detectedRecall := s.ScrubCmdLine(record.RecallLastCmdLine)
+	if len(detected) == 0 && len(detectedRecall) == 0 {
+		return true
+	}
+	record.ScrubAction = s.action
+	record.ScrubDetectors = mergeNames(record.ScrubDetectors, append(detected, detectedRecall...))
+	if s.action == ActionDrop {
+		return false
+	}
+	record.CmdLine = cmdLine
+	record.RecallLastCmdLine = recallLastCmdLine
+	return true
+}
+
+// isHighEntropy returns true for long random-looking tokens
+//		tokens have to contain lowercase and uppercase letters and digits to exclude hex hashes, UUIDs and words
+//		tokens with "/" or "-" are skipped (paths, git branches, package names, ...)
+func (s *Scrubber) isHighEntropy(token string) bool {
+	if len(token) < s.entropyMinLength || strings.ContainsAny(token, "/-") {
+		return false
+	}
+	var lower, upper, digit bool
+	for _, r := range token {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if lower == false || upper == false || digit == false {
+		return false
+	}
+	return Entropy(token) >= s.entropyThreshold
+}
+
+// Entropy returns shannon entropy of the string in bits per character
+func Entropy(str string) float64 {
+	if len(str) == 0 {
+		return 0
+	}
+	counts := map[rune]int{}
+	length := 0
+	for _, r := range str {
+		counts[r]++
+		length++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(length)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func mergeNames(names []string, more []string) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, name := range append(names, more...) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		res = append(res, name)
+	}
+	return res
+}
@@ -0,0 +1,217 @@
+package sesshist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/curusarn/resh/pkg/histlist"
+	"github.com/curusarn/resh/pkg/records"
+	"github.com/curusarn/resh/pkg/sess"
+	"github.com/mitchellh/go-ps"
+)
+
+const defaultPersistPeriod = 60 * time.Second
+
+// sesshistState is a serializable snapshot of sesshist
+type sesshistState struct {
+	SessionID  string `json:"sessionId"`
+	SessionPID int    `json:"sessionPid"`
+	// identity of the session process - PID alone can be reused by another process
+	SessionProcess processIdentity `json:"sessionProcess"`
+	Shell          string          `json:"shell"`
+	ShareMode      string          `json:"shareMode"`
+
+	RecentRecords   []records.Record `json:"recentRecords"`
+	HistoryCmdLines []string         `json:"historyCmdLines"`
+	OwnCmdLines     []string         `json:"ownCmdLines"`
+	SharedCmdLines  []string         `json:"sharedCmdLines"`
+	PendingCmdLines []string         `json:"pendingCmdLines"`
+}
+
+// dispatchState is a serializable snapshot of all sessions
+type dispatchState struct {
+	Sessions []sesshistState `json:"sessions"`
+}
+
+// persister saves sessions periodically and on shutdown
+func (s *Dispatch) persister(period time.Duration, signals chan os.Signal, shutdownDone chan string) {
+	if period == 0 {
+		period = defaultPersistPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.persistSessions()
+		case sig := <-signals:
+			log.Println("sesshist: Got signal " + sig.String())
+			s.persistSessions()
+			log.Println("sesshist DEBUG: Shutdown success")
+			shutdownDone <- "sesshist"
+			return
+		}
+	}
+}
+
+// persistSessions writes all sessions to the state file
+func (s *Dispatch) persistSessions() {
+	if s.statePath == "" {
+		return
+	}
+	var state dispatchState
+	s.mutex.RLock()
+	for sessionID, session := range s.sessions {
+		state.Sessions = append(state.Sessions, session.snapshot(sessionID))
+	}
+	s.mutex.RUnlock()
+
+	jsn, err := json.Marshal(state)
+	if err != nil {
+		log.Println("sesshist ERROR: Marshalling error while persisting sessions:", err)
+		return
+	}
+	// write to a temporary file first so we never leave a half written state behind
+	tmpPath := s.statePath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, jsn, 0600)
+	if err != nil {
+		log.Println("sesshist ERROR: Could not write sessions state:", err)
+		return
+	}
+	err = os.Rename(tmpPath, s.statePath)
+	if err != nil {
+		log.Println("sesshist ERROR: Could not replace sessions state file:", err)
+		return
+	}
+	log.Println("sesshist: persisted", len(state.Sessions), "sessions")
+}
+
+// restoreSessions loads persisted sessions that are still alive
+func (s *Dispatch) restoreSessions() {
+	if s.statePath == "" {
+		return
+	}
+	jsn, err := ioutil.ReadFile(s.statePath)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			log.Println("sesshist ERROR: Could not read sessions state:", err)
+		}
+		return
+	}
+	var state dispatchState
+	err = json.Unmarshal(jsn, &state)
+	if err != nil {
+		log.Println("sesshist ERROR: Decoding error while restoring sessions:", err)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, sessState := range state.Sessions {
+		if isSameProcess(sessState.SessionPID, sessState.SessionProcess) == false {
+			log.Println("sesshist: not restoring dead session ~ pid:", sessState.SessionID, "~", sessState.SessionPID)
+			continue
+		}
+		s.sessions[sessState.SessionID] = newSesshistFromState(sessState, s.historyInitSize)
+		log.Println("sesshist: restored session ~ pid:", sessState.SessionID, "~", sessState.SessionPID,
+			"; session len:", len(sessState.HistoryCmdLines)+len(sessState.OwnCmdLines))
+	}
+}
+
+// Sessions returns IDs and PIDs of all session histories - used to start watching restored sessions
+func (s *Dispatch) Sessions() []sess.Session {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var sessions []sess.Session
+	for sessionID, session := range s.sessions {
+		sessions = append(sessions, sess.Session{ID: sessionID, PID: session.sessionPID})
+	}
+	return sessions
+}
+
+// processIdentity tells apart processes with the same PID
+type processIdentity struct {
+	Executable string `json:"executable"`
+	PPID       int    `json:"ppid"`
+}
+
+// readProcessIdentity returns identity of the running process (zero value if the process doesn't exist)
+func readProcessIdentity(pid int) processIdentity {
+	if pid <= 0 {
+		return processIdentity{}
+	}
+	proc, err := ps.FindProcess(pid)
+	if err != nil {
+		log.Println("sesshist ERROR: error while finding process:", pid)
+		return processIdentity{}
+	}
+	if proc == nil {
+		return processIdentity{}
+	}
+	return processIdentity{Executable: proc.Executable(), PPID: proc.PPid()}
+}
+
+// isSameProcess returns true if the process is alive and it's still the same process (PID was not reused)
+//		state saved by older versions without the identity is not restored
+func isSameProcess(pid int, identity processIdentity) bool {
+	if identity.Executable == "" {
+		return false
+	}
+	return readProcessIdentity(pid) == identity
+}
+
+func (s *sesshist) snapshot(sessionID string) sesshistState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// copy everything - histlists get modified in place
+	state := sesshistState{
+		SessionID:       sessionID,
+		SessionPID:      s.sessionPID,
+		SessionProcess:  s.sessionProcess,
+		Shell:           s.shell,
+		ShareMode:       s.shareMode,
+		RecentRecords:   append([]records.Record{}, s.recentRecords...),
+		HistoryCmdLines: append([]string{}, s.historyCmdLines.List...),
+		OwnCmdLines:     append([]string{}, s.ownCmdLines.List...),
+		PendingCmdLines: append([]string{}, s.pendingCmdLines...),
+	}
+	for cmdLine := range s.sharedCmdLines {
+		state.SharedCmdLines = append(state.SharedCmdLines, cmdLine)
+	}
+	return state
+}
+
+func newSesshistFromState(state sesshistState, historyLimit int) *sesshist {
+	s := sesshist{
+		sessionPID:      state.SessionPID,
+		sessionProcess:  state.SessionProcess,
+		shell:           state.Shell,
+		shareMode:       state.ShareMode,
+		recentRecords:   state.RecentRecords,
+		historyCmdLines: histlistFromList(state.HistoryCmdLines),
+		ownCmdLines:     histlistFromList(state.OwnCmdLines),
+		historyLimit:    historyLimit,
+		sharedCmdLines:  map[string]bool{},
+		pendingCmdLines: state.PendingCmdLines,
+	}
+	if IsValidShareMode(s.shareMode) == false {
+		s.shareMode = ShareOff
+	}
+	for _, cmdLine := range state.SharedCmdLines {
+		s.sharedCmdLines[cmdLine] = true
+	}
+	s.recentCmdLines = histlist.Copy(s.historyCmdLines)
+	s.recentCmdLines.AddHistlist(s.ownCmdLines)
+	s.trimRecentRecords()
+	return &s
+}
+
+func histlistFromList(cmdLines []string) histlist.Histlist {
+	hl := histlist.New()
+	for _, cmdLine := range cmdLines {
+		hl.AddCmdLine(cmdLine)
+	}
+	return hl
+}
@@ -3,15 +3,32 @@ package sesshist
 import (
 	"errors"
 	"log"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/curusarn/resh/pkg/histfile"
 	"github.com/curusarn/resh/pkg/histlist"
 	"github.com/curusarn/resh/pkg/records"
 )
 
+// Share history modes
+const (
+	// ShareOff - session only sees its own commands (and history loaded at session init)
+	ShareOff = "off"
+	// ShareImmediate - commands from other sessions are added to the recall list right away
+	ShareImmediate = "immediate"
+	// SharePrompt - commands from other sessions are added to the recall list at the next prompt
+	SharePrompt = "prompt"
+)
+
+// IsValidShareMode returns true if mode is one of the share history modes
+func IsValidShareMode(mode string) bool {
+	return mode == ShareOff || mode == ShareImmediate || mode == SharePrompt
+}
+
 // Dispatch Recall() calls to an apropriate session history (sesshist)
 type Dispatch struct {
 	sessions map[string]*sesshist
@@ -19,20 +36,37 @@ type Dispatch struct {
 
 	history         *histfile.Histfile
 	historyInitSize int
+	shareMode       string
+
+	// sessions are persisted to this file so they survive daemon restarts
+	statePath string
 }
 
-// NewDispatch creates a new sesshist.Dispatch and starts necessary gorutines
+// NewDispatch creates a new sesshist.Dispatch, restores persisted sessions and starts necessary gorutines
 func NewDispatch(sessionsToInit chan records.Record, sessionsToDrop chan string,
-	recordsToAdd chan records.Record, history *histfile.Histfile, historyInitSize int) *Dispatch {
+	recordsToAdd chan records.Record, history *histfile.Histfile, historyInitSize int,
+	shareMode string, statePath string, persistPeriodSeconds uint,
+	signals chan os.Signal, shutdownDone chan string) *Dispatch {
 
+	if shareMode == "" {
+		shareMode = ShareOff
+	}
+	if IsValidShareMode(shareMode) == false {
+		log.Println("sesshist ERROR: Unknown share history mode:", shareMode, "- using:", ShareOff)
+		shareMode = ShareOff
+	}
 	s := Dispatch{
 		sessions:        map[string]*sesshist{},
 		history:         history,
 		historyInitSize: historyInitSize,
+		shareMode:       shareMode,
+		statePath:       statePath,
 	}
+	s.restoreSessions()
 	go s.sessionInitializer(sessionsToInit)
 	go s.sessionDropper(sessionsToDrop)
 	go s.recordAdder(recordsToAdd)
+	go s.persister(time.Duration(persistPeriodSeconds)*time.Second, signals, shutdownDone)
 	return &s
 }
 
@@ -40,7 +74,7 @@ func (s *Dispatch) sessionInitializer(sessionsToInit chan records.Record) {
 	for {
 		record := <-sessionsToInit
 		log.Println("sesshist: got session to init - " + record.SessionID)
-		s.initSession(record.SessionID, record.Shell)
+		s.initSession(record.SessionID, record.Shell, record.SessionPID)
 	}
 }
 
@@ -60,18 +94,19 @@ func (s *Dispatch) recordAdder(recordsToAdd chan records.Record) {
 			s.addRecentRecord(record.SessionID, record)
 		} else {
 			// this inits session on RESH update
-			s.checkSession(record.SessionID, record.Shell)
+			s.checkSession(record.SessionID, record.Shell, record.SessionPID)
+			// part2 is sent right before the prompt is shown
+			s.flushSharedCmdLines(record.SessionID)
 		}
-		// TODO: we will need to handle part2 as well eventually
 	}
 }
 
-func (s *Dispatch) checkSession(sessionID, shell string) {
+func (s *Dispatch) checkSession(sessionID, shell string, sessionPID int) {
 	s.mutex.RLock()
 	_, found := s.sessions[sessionID]
 	s.mutex.RUnlock()
 	if found == false {
-		err := s.initSession(sessionID, shell)
+		err := s.initSession(sessionID, shell, sessionPID)
 		if err != nil {
 			log.Println("sesshist: Error while checking session:", err)
 		}
@@ -79,7 +114,7 @@ func (s *Dispatch) checkSession(sessionID, shell string) {
 }
 
 // InitSession struct
-func (s *Dispatch) initSession(sessionID, shell string) error {
+func (s *Dispatch) initSession(sessionID, shell string, sessionPID int) error {
 	log.Println("sesshist: initializing session - " + sessionID)
 	s.mutex.RLock()
 	_, found := s.sessions[sessionID]
@@ -91,12 +126,25 @@ func (s *Dispatch) initSession(sessionID, shell string) error {
 
 	log.Println("sesshist: loading history to populate session - " + sessionID)
 	historyCmdLines := s.history.GetRecentCmdLines(shell, s.historyInitSize)
+	sessionProcess := readProcessIdentity(sessionPID)
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	if _, found := s.sessions[sessionID]; found {
+		// session was initialized while we were loading the history
+		return errors.New("sesshist ERROR: Can't INIT already existing session " + sessionID)
+	}
 	// init sesshist and populate it with history loaded from file
 	s.sessions[sessionID] = &sesshist{
-		recentCmdLines: historyCmdLines,
+		sessionPID:      sessionPID,
+		sessionProcess:  sessionProcess,
+		shell:           shell,
+		recentCmdLines:  historyCmdLines,
+		historyCmdLines: histlist.Copy(historyCmdLines),
+		ownCmdLines:     histlist.New(),
+		historyLimit:    s.historyInitSize,
+		sharedCmdLines:  map[string]bool{},
+		shareMode:       s.shareMode,
 	}
 	log.Println("sesshist: session init done - " + sessionID)
 	return nil
@@ -129,21 +177,94 @@ func (s *Dispatch) addRecentRecord(sessionID string, record records.Record) erro
 
 	if found == false {
 		log.Println("sesshist ERROR: addRecentRecord(): No session history for SessionID " + sessionID + " - creating session history.")
-		s.initSession(sessionID, record.Shell)
+		s.initSession(sessionID, record.Shell, record.SessionPID)
 		return s.addRecentRecord(sessionID, record)
 	}
 	log.Println("sesshist: RLocking session lock (w/ defer) ...")
 	session.mutex.Lock()
-	defer session.mutex.Unlock()
 	session.recentRecords = append(session.recentRecords, record)
+	session.trimRecentRecords()
 	session.recentCmdLines.AddCmdLine(record.CmdLine)
+	session.ownCmdLines.AddCmdLine(record.CmdLine)
+	delete(session.sharedCmdLines, record.CmdLine)
 	log.Println("sesshist: record:", record.CmdLine, "; added to session:", sessionID,
 		"; session len:", len(session.recentCmdLines.List), "; session len (records):", len(session.recentRecords))
+	session.mutex.Unlock()
+
+	s.shareCmdLine(sessionID, record.CmdLine)
 	return nil
 }
 
+// shareCmdLine with all other sessions that have history sharing enabled
+func (s *Dispatch) shareCmdLine(sourceSessionID, cmdLine string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for sessionID, session := range s.sessions {
+		if sessionID == sourceSessionID {
+			continue
+		}
+		session.addSharedCmdLine(cmdLine)
+	}
+}
+
+// flushSharedCmdLines adds pending shared cmdLines to the recall list of the session
+func (s *Dispatch) flushSharedCmdLines(sessionID string) {
+	s.mutex.RLock()
+	session, found := s.sessions[sessionID]
+	s.mutex.RUnlock()
+	if found == false {
+		return
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.mergeSharedCmdLines()
+}
+
+// SetShareMode for given session - empty sessionID sets the default for new sessions
+func (s *Dispatch) SetShareMode(sessionID string, mode string) error {
+	if IsValidShareMode(mode) == false {
+		return errors.New("sesshist ERROR: Unknown share history mode: " + mode)
+	}
+	if sessionID == "" {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.shareMode = mode
+		log.Println("sesshist: default share history mode set to:", mode)
+		return nil
+	}
+	s.mutex.RLock()
+	session, found := s.sessions[sessionID]
+	s.mutex.RUnlock()
+	if found == false {
+		return errors.New("sesshist ERROR: No session history for SessionID " + sessionID)
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.shareMode = mode
+	if mode == ShareOff {
+		session.pendingCmdLines = nil
+	} else {
+		// don't keep commands waiting if the mode changed from prompt to immediate
+		session.mergeSharedCmdLines()
+	}
+	log.Println("sesshist: share history mode set to:", mode, "; session:", sessionID)
+	return nil
+}
+
+// RemoveCmdLines from all session histories (e.g. when they were deleted from the history)
+func (s *Dispatch) RemoveCmdLines(cmdLines []string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, session := range s.sessions {
+		session.removeCmdLines(cmdLines)
+	}
+	log.Println("sesshist: removed", len(cmdLines), "cmdLines from", len(s.sessions), "sessions")
+}
+
 // Recall command from recent session history
-func (s *Dispatch) Recall(sessionID string, histno int, prefix string) (string, error) {
+//		returns true if the recalled command was shared from another session
+//		shell and sessionPID are only used to create missing session history
+func (s *Dispatch) Recall(sessionID, shell string, sessionPID int, histno int, prefix string) (string, bool, error) {
 	log.Println("sesshist - recall: RLocking main lock ...")
 	s.mutex.RLock()
 	log.Println("sesshist - recall: Getting session history struct ...")
@@ -151,19 +272,29 @@ func (s *Dispatch) Recall(sessionID string, histno int, prefix string) (string,
 	s.mutex.RUnlock()
 
 	if found == false {
-		// TODO: propagate actual shell here so we can use it
-		go s.initSession(sessionID, "bash")
-		return "", errors.New("sesshist ERROR: No session history for SessionID " + sessionID + " - creating one ...")
+		if shell == "" {
+			log.Println("sesshist WARN: recall: Unknown shell for SessionID " + sessionID + " - using bash")
+			shell = "bash"
+		}
+		go s.initSession(sessionID, shell, sessionPID)
+		return "", false, errors.New("sesshist ERROR: No session history for SessionID " + sessionID + " - creating one ...")
 	}
 	log.Println("sesshist - recall: Locking session lock ...")
 	session.mutex.Lock()
 	defer session.mutex.Unlock()
+	var cmdLine string
+	var err error
 	if prefix == "" {
 		log.Println("sesshist - recall: Getting records by histno ...")
-		return session.getRecordByHistno(histno)
+		cmdLine, err = session.getRecordByHistno(histno)
+	} else {
+		log.Println("sesshist - recall: Searching for records by prefix ...")
+		cmdLine, err = session.searchRecordByPrefix(prefix, histno)
 	}
-	log.Println("sesshist - recall: Searching for records by prefix ...")
-	return session.searchRecordByPrefix(prefix, histno)
+	if err != nil {
+		return "", false, err
+	}
+	return cmdLine, session.sharedCmdLines[cmdLine], nil
 }
 
 // Inspect commands in recent session history
@@ -195,9 +326,104 @@ func (s *Dispatch) Inspect(sessionID string, count int) ([]string, error) {
 }
 
 type sesshist struct {
-	mutex          sync.Mutex
+	mutex      sync.Mutex
+	sessionPID int
+	// used to check that the session process is still the same when the session is restored
+	sessionProcess processIdentity
+	shell          string
 	recentRecords  []records.Record
+	// recall list = history (incl. shared cmdLines) followed by own cmdLines
 	recentCmdLines histlist.Histlist
+
+	// history loaded during init + cmdLines shared from other sessions
+	historyCmdLines histlist.Histlist
+	// cmdLines executed in this session
+	ownCmdLines histlist.Histlist
+	// max length of historyCmdLines, pendingCmdLines and recentRecords (older ones are dropped)
+	historyLimit int
+
+	shareMode string
+	// lookup: cmdLine -> was shared from another session
+	sharedCmdLines map[string]bool
+	// shared cmdLines waiting for the next prompt
+	pendingCmdLines []string
+}
+
+// addSharedCmdLine from another session based on share mode of this session
+func (s *sesshist) addSharedCmdLine(cmdLine string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch s.shareMode {
+	case ShareImmediate:
+		s.pendingCmdLines = append(s.pendingCmdLines, cmdLine)
+		s.mergeSharedCmdLines()
+	case SharePrompt:
+		s.pendingCmdLines = append(s.pendingCmdLines, cmdLine)
+		if s.historyLimit > 0 && len(s.pendingCmdLines) > s.historyLimit {
+			s.pendingCmdLines = append([]string{}, s.pendingCmdLines[len(s.pendingCmdLines)-s.historyLimit:]...)
+		}
+	}
+}
+
+func (s *sesshist) removeCmdLines(cmdLines []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	toRemove := map[string]bool{}
+	for _, cmdLine := range cmdLines {
+		toRemove[cmdLine] = true
+		s.recentCmdLines.RemoveCmdLine(cmdLine)
+		s.historyCmdLines.RemoveCmdLine(cmdLine)
+		s.ownCmdLines.RemoveCmdLine(cmdLine)
+		delete(s.sharedCmdLines, cmdLine)
+	}
+	var pending []string
+	for _, cmdLine := range s.pendingCmdLines {
+		if toRemove[cmdLine] == false {
+			pending = append(pending, cmdLine)
+		}
+	}
+	s.pendingCmdLines = pending
+	var recentRecords []records.Record
+	for _, rec := range s.recentRecords {
+		if toRemove[rec.CmdLine] == false {
+			recentRecords = append(recentRecords, rec)
+		}
+	}
+	s.recentRecords = recentRecords
+}
+
+// trimRecentRecords drops the oldest records over the history limit
+//		expects the session to be locked
+func (s *sesshist) trimRecentRecords() {
+	if s.historyLimit > 0 && len(s.recentRecords) > s.historyLimit {
+		s.recentRecords = append([]records.Record{}, s.recentRecords[len(s.recentRecords)-s.historyLimit:]...)
+	}
+}
+
+// mergeSharedCmdLines into recall list while keeping own commands first
+//		shared cmdLines are inserted in place right before own cmdLines
+//		expects the session to be locked
+func (s *sesshist) mergeSharedCmdLines() {
+	if len(s.pendingCmdLines) == 0 {
+		return
+	}
+	for _, cmdLine := range s.pendingCmdLines {
+		s.historyCmdLines.AddCmdLine(cmdLine)
+		if _, found := s.ownCmdLines.LastIndex[cmdLine]; found {
+			continue
+		}
+		s.sharedCmdLines[cmdLine] = true
+		s.recentCmdLines.InsertCmdLine(len(s.recentCmdLines.List)-len(s.ownCmdLines.List), cmdLine)
+	}
+	log.Println("sesshist: merged", len(s.pendingCmdLines), "shared cmdLines into session history")
+	s.pendingCmdLines = nil
+	if s.historyLimit > 0 {
+		s.historyCmdLines.Trim(s.historyLimit)
+		// own cmdLines are at the end of the recall list so they are never dropped
+		for _, cmdLine := range s.recentCmdLines.Trim(s.historyLimit + len(s.ownCmdLines.List)) {
+			delete(s.sharedCmdLines, cmdLine)
+		}
+	}
 }
 
 func (s *sesshist) getRecordByHistno(histno int) (string, error) {
@@ -0,0 +1,202 @@
+package sesstree
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/curusarn/resh/pkg/records"
+)
+
+// maximum number of sessions kept in the tree - oldest sessions are dropped first
+const maxSessions = 10000
+
+// Session is a node of the session tree
+type Session struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parentId,omitempty"`
+	PID      int    `json:"pid"`
+	Shell    string `json:"shell"`
+	Shlvl    int    `json:"shlvl"`
+	Host     string `json:"host"`
+	Login    string `json:"login"`
+	// RealtimeStart - unix time of the session init
+	RealtimeStart float64 `json:"realtimeStart"`
+
+	TmuxSession string `json:"tmuxSession,omitempty"`
+	TmuxWindow  string `json:"tmuxWindow,omitempty"`
+	TmuxPane    string `json:"tmuxPane,omitempty"`
+	SSHClient   string `json:"sshClient,omitempty"`
+}
+
+// Tree keeps parent/child relationships of sessions and persists them to a file
+type Tree struct {
+	mutex sync.RWMutex
+	path  string
+	// lookup: session ID -> session
+	sessions map[string]Session
+}
+
+// New creates Tree, loads it from given file and starts adding sessions from sessionsToInit
+func New(path string, sessionsToInit chan records.Record) *Tree {
+	t := Tree{
+		path:     path,
+		sessions: map[string]Session{},
+	}
+	jsn, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			log.Println("sesstree ERROR: failed to read sessions file:", err)
+		}
+	} else {
+		var sessions []Session
+		err = json.Unmarshal(jsn, &sessions)
+		if err != nil {
+			log.Println("sesstree ERROR: failed to decode sessions file:", err)
+		}
+		for _, session := range sessions {
+			t.sessions[session.ID] = session
+		}
+	}
+	go func() {
+		for record := range sessionsToInit {
+			t.Add(record)
+		}
+	}()
+	return &t
+}
+
+// NewSession creates session from a record of the session (e.g. session init record)
+func NewSession(record records.Record) Session {
+	session := Session{
+		ID:            record.SessionID,
+		ParentID:      record.ParentSessionID,
+		PID:           record.SessionPID,
+		Shell:         record.Shell,
+		Shlvl:         record.Shlvl,
+		Host:          record.Host,
+		Login:         record.Login,
+		RealtimeStart: record.RealtimeBefore,
+		TmuxSession:   record.TmuxSession,
+		TmuxWindow:    record.TmuxWindow,
+		TmuxPane:      record.TmuxPane,
+		SSHClient:     record.SSHClient,
+	}
+	if session.ParentID == session.ID {
+		session.ParentID = ""
+	}
+	return session
+}
+
+// Add session from session init record and save
+func (t *Tree) Add(record records.Record) error {
+	if record.SessionID == "" {
+		return nil
+	}
+	session := NewSession(record)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sessions[session.ID] = session
+	log.Println("sesstree: added session:", session.ID, "- parent:", session.ParentID)
+	return t.save()
+}
+
+// Get session by ID
+func (t *Tree) Get(id string) (Session, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	session, found := t.sessions[id]
+	return session, found
+}
+
+// Sessions returns all sessions sorted by start time
+func (t *Tree) Sessions() []Session {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.sortedSessions()
+}
+
+// Subtree returns the session and all its descendants sorted by start time
+func (t *Tree) Subtree(id string) []Session {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	var res []Session
+	for _, session := range t.sortedSessions() {
+		if t.isDescendant(session.ID, id) {
+			res = append(res, session)
+		}
+	}
+	return res
+}
+
+// Enrich copies session context (parent, tmux, SSH) to a record of the session
+func (t *Tree) Enrich(record *records.Record) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	session, found := t.sessions[record.SessionID]
+	if found == false {
+		return
+	}
+	record.ParentSessionID = session.ParentID
+	record.TmuxSession = session.TmuxSession
+	record.TmuxWindow = session.TmuxWindow
+	record.TmuxPane = session.TmuxPane
+	record.SSHClient = session.SSHClient
+}
+
+// isDescendant returns true if the session is the ancestor or its descendant
+//		expects tree to be locked
+func (t *Tree) isDescendant(id, ancestorID string) bool {
+	// guard against cycles in corrupted data
+	for i := 0; i <= len(t.sessions); i++ {
+		if id == ancestorID {
+			return true
+		}
+		session, found := t.sessions[id]
+		if found == false || session.ParentID == "" {
+			return false
+		}
+		id = session.ParentID
+	}
+	return false
+}
+
+// sortedSessions expects tree to be locked
+func (t *Tree) sortedSessions() []Session {
+	sessions := make([]Session, 0, len(t.sessions))
+	for _, session := range t.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].RealtimeStart == sessions[j].RealtimeStart {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].RealtimeStart < sessions[j].RealtimeStart
+	})
+	return sessions
+}
+
+// save expects tree to be locked
+func (t *Tree) save() error {
+	sessions := t.sortedSessions()
+	if len(sessions) > maxSessions {
+		for _, session := range sessions[:len(sessions)-maxSessions] {
+			delete(t.sessions, session.ID)
+		}
+		sessions = sessions[len(sessions)-maxSessions:]
+	}
+	jsn, err := json.Marshal(sessions)
+	if err != nil {
+		log.Println("sesstree ERROR: failed to encode sessions:", err)
+		return err
+	}
+	err = ioutil.WriteFile(t.path, jsn, 0644)
+	if err != nil {
+		log.Println("sesstree ERROR: failed to write sessions file:", err)
+		return err
+	}
+	return nil
+}
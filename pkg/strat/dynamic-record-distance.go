@@ -55,8 +55,10 @@ func (s *DynamicRecordDistance) GetCandidates(strippedRecord records.EnrichedRec
 			Pwd:       s.DistParams.Pwd * s.idf(s.pwdHistogram[strippedRecord.PwdAfter]),
 			RealPwd:   s.DistParams.RealPwd * s.idf(s.realPwdHistogram[strippedRecord.RealPwdAfter]),
 			Git:       s.DistParams.Git * s.idf(s.gitOriginHistogram[strippedRecord.GitOriginRemote]),
+			GitBranch: s.DistParams.GitBranch,
 			Time:      s.DistParams.Time,
 			SessionID: s.DistParams.SessionID,
+			Extra:     s.DistParams.Extra,
 		}
 		distance := record.DistanceTo(strippedRecord, distParams)
 		mapItems = append(mapItems, strDynDistEntry{record.CmdLine, distance})
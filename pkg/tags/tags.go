@@ -0,0 +1,120 @@
+package tags
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Favourite is a tag used for favourite commands
+const Favourite = "favourite"
+
+// Tags keeps user defined tags of command lines and persists them to a file
+type Tags struct {
+	mutex sync.RWMutex
+	path  string
+	// lookup: cmdLine -> tags
+	tags map[string][]string
+}
+
+// New creates Tags and loads them from given file
+func New(path string) *Tags {
+	t := Tags{
+		path: path,
+		tags: map[string][]string{},
+	}
+	jsn, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			log.Println("tags ERROR: failed to read tags file:", err)
+		}
+		return &t
+	}
+	err = json.Unmarshal(jsn, &t.tags)
+	if err != nil {
+		log.Println("tags ERROR: failed to decode tags file:", err)
+		t.tags = map[string][]string{}
+	}
+	return &t
+}
+
+// Get tags of the cmdLine
+func (t *Tags) Get(cmdLine string) []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.tags[cmdLine]
+}
+
+// Add tag to cmdLines and save
+func (t *Tags) Add(cmdLines []string, tag string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, cmdLine := range cmdLines {
+		if hasTag(t.tags[cmdLine], tag) {
+			continue
+		}
+		// new slice - slices returned by Get can still be in use
+		cmdTags := make([]string, 0, len(t.tags[cmdLine])+1)
+		cmdTags = append(append(cmdTags, t.tags[cmdLine]...), tag)
+		sort.Strings(cmdTags)
+		t.tags[cmdLine] = cmdTags
+	}
+	return t.save()
+}
+
+// Remove tag from cmdLines and save
+func (t *Tags) Remove(cmdLines []string, tag string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, cmdLine := range cmdLines {
+		var cmdTags []string
+		for _, cmdTag := range t.tags[cmdLine] {
+			if cmdTag != tag {
+				cmdTags = append(cmdTags, cmdTag)
+			}
+		}
+		if len(cmdTags) == 0 {
+			delete(t.tags, cmdLine)
+			continue
+		}
+		t.tags[cmdLine] = cmdTags
+	}
+	return t.save()
+}
+
+// RemoveCmdLines removes all tags of cmdLines and saves
+func (t *Tags) RemoveCmdLines(cmdLines []string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, cmdLine := range cmdLines {
+		delete(t.tags, cmdLine)
+	}
+	return t.save()
+}
+
+// save expects tags to be locked
+func (t *Tags) save() error {
+	jsn, err := json.Marshal(t.tags)
+	if err != nil {
+		log.Println("tags ERROR: failed to encode tags:", err)
+		return err
+	}
+	err = ioutil.WriteFile(t.path, jsn, 0644)
+	if err != nil {
+		log.Println("tags ERROR: failed to write tags file:", err)
+		return err
+	}
+	return nil
+}
+
+func hasTag(cmdTags []string, tag string) bool {
+	for _, cmdTag := range cmdTags {
+		if cmdTag == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -35,12 +35,7 @@ __resh_collect() {
     
     # non-posix
     local __RESH_SHLVL="$SHLVL"
-    local __RESH_GIT_CDUP; __RESH_GIT_CDUP="$(git rev-parse --show-cdup 2>/dev/null)"
-    local __RESH_GIT_CDUP_EXIT_CODE=$?
-    local __RESH_GIT_REMOTE; __RESH_GIT_REMOTE="$(git remote get-url origin 2>/dev/null)"
-    local __RESH_GIT_REMOTE_EXIT_CODE=$?
-    #__RESH_GIT_TOPLEVEL="$(git rev-parse --show-toplevel)"
-    #__RESH_GIT_TOPLEVEL_EXIT_CODE=$?
+    # git info is read from .git by resh-collect
 
     if [ -n "${ZSH_VERSION-}" ]; then
         # assume Zsh
@@ -97,10 +92,6 @@ __resh_collect() {
                     -ostype "$__RESH_OSTYPE" \
                     -machtype "$__RESH_MACHTYPE" \
                     -shlvl "$__RESH_SHLVL" \
-                    -gitCdup "$__RESH_GIT_CDUP" \
-                    -gitCdupExitCode "$__RESH_GIT_CDUP_EXIT_CODE" \
-                    -gitRemote "$__RESH_GIT_REMOTE" \
-                    -gitRemoteExitCode "$__RESH_GIT_REMOTE_EXIT_CODE" \
                     -realtimeBefore "$__RESH_RT_BEFORE" \
                     -realtimeSession "$__RESH_RT_SESSION" \
                     -realtimeSessSinceBoot "$__RESH_RT_SESS_SINCE_BOOT" \
@@ -117,23 +108,34 @@ __resh_collect() {
         return 1
 }
 
+# older bash-preexec doesn't save $PIPESTATUS to $BP_PIPESTATUS and $PIPESTATUS is overwritten before precmd functions run
+#   => save it in our own PROMPT_COMMAND hook that runs before the bash-preexec one
+#   "$_" is passed to keep the last argument of the command for bash-preexec
+__resh_save_pipestatus() {
+    __RESH_BASH_PIPESTATUS="${PIPESTATUS[*]}" __RESH_BASH_EXIT_CODE=$?
+    return "$__RESH_BASH_EXIT_CODE"
+}
+
+__resh_install_save_pipestatus() {
+    if [ -n "${BP_PIPESTATUS+x}" ] || [[ "${PROMPT_COMMAND-}" == *__resh_save_pipestatus* ]]; then
+        return
+    fi
+    # bash-preexec puts its hook at the start of PROMPT_COMMAND when it's installed (before the first prompt)
+    PROMPT_COMMAND='__resh_save_pipestatus "$_"'$'\n'"${PROMPT_COMMAND-}"
+}
+
 __resh_precmd() {
-    local __RESH_EXIT_CODE=$?
+    # has to be the first command to keep both $? and pipeline statuses
+    # bash: bash-preexec saves $PIPESTATUS to $BP_PIPESTATUS (or __resh_save_pipestatus for older versions), zsh: $pipestatus
+    local __RESH_EXIT_CODE=$? __RESH_PIPESTATUS="${BP_PIPESTATUS[*]-${__RESH_BASH_PIPESTATUS-}}${pipestatus[*]-}"
+    [ "${__RESH_SHELL-}" = bash ] && __resh_install_save_pipestatus
     local __RESH_RT_AFTER
     local __RESH_TZ_AFTER
     local __RESH_PWD_AFTER
-    local __RESH_GIT_CDUP_AFTER
-    local __RESH_GIT_CDUP_EXIT_CODE_AFTER
-    local __RESH_GIT_REMOTE_AFTER
-    local __RESH_GIT_REMOTE_EXIT_CODE_AFTER
     local __RESH_SHLVL="$SHLVL"
     __RESH_RT_AFTER=$(__resh_get_epochrealtime)
     __RESH_TZ_AFTER=$(date +%z)
     __RESH_PWD_AFTER="$PWD"
-    __RESH_GIT_CDUP_AFTER="$(git rev-parse --show-cdup 2>/dev/null)"
-    __RESH_GIT_CDUP_EXIT_CODE_AFTER=$?
-    __RESH_GIT_REMOTE_AFTER="$(git remote get-url origin 2>/dev/null)"
-    __RESH_GIT_REMOTE_EXIT_CODE_AFTER=$?
     if [ -n "${__RESH_COLLECT}" ]; then
         if [ "$__RESH_VERSION" != "$(resh-postcollect -version)" ]; then
             # shellcheck source=shellrc.sh
@@ -156,14 +158,11 @@ __resh_precmd() {
                         -cmdLine "$__RESH_CMDLINE" \
                         -realtimeBefore "$__RESH_RT_BEFORE" \
                         -exitCode "$__RESH_EXIT_CODE" \
+                        -pipeStatus "$__RESH_PIPESTATUS" \
                         -sessionId "$__RESH_SESSION_ID" \
                         -shell "$__RESH_SHELL" \
                         -shlvl "$__RESH_SHLVL" \
                         -pwdAfter "$__RESH_PWD_AFTER" \
-                        -gitCdupAfter "$__RESH_GIT_CDUP_AFTER" \
-                        -gitCdupExitCodeAfter "$__RESH_GIT_CDUP_EXIT_CODE_AFTER" \
-                        -gitRemoteAfter "$__RESH_GIT_REMOTE_AFTER" \
-                        -gitRemoteExitCodeAfter "$__RESH_GIT_REMOTE_EXIT_CODE_AFTER" \
                         -realtimeAfter "$__RESH_RT_AFTER" \
                         -timezoneAfter "$__RESH_TZ_AFTER" \
                         >| ~/.resh/postcollect_last_run_out.txt 2>&1 || echo "resh-postcollect ERROR: $(head -n 1 ~/.resh/postcollect_last_run_out.txt)"
@@ -8,7 +8,7 @@ echo "Checking your system ..."
 # /usr/bin/zsh -> zsh
 login_shell=$(echo "$SHELL" | rev | cut -d'/' -f1 | rev)
 
-if [ "$login_shell" != bash ] && [ "$login_shell" != zsh ]; then
+if [ "$login_shell" != bash ] && [ "$login_shell" != zsh ] && [ "$login_shell" != fish ]; then
     echo "ERROR: Unsupported/unknown login shell: $login_shell"
     exit 1
 fi
@@ -64,6 +64,22 @@ else
 fi
 
 
+if ! fish --version >/dev/null 2>&1; then
+    echo " * Fish not installed - skipping fish integration"
+else
+    fish_version=$(fish -c 'echo $version')
+    fish_version_major=$(echo "$fish_version" | cut -d'.' -f1)
+    fish_version_minor=$(echo "$fish_version" | cut -d'.' -f2)
+    if [ "$fish_version_major" -lt 3 ] || { [ "$fish_version_major" -eq 3 ] && [ "$fish_version_minor" -lt 1 ]; }; then
+        echo " * Fish version: $fish_version - UNSUPPORTED!"
+        echo "   > Your fish version is old."
+        echo "   > Updating to fish 3.1+ is required for fish integration."
+    else
+        echo " * Fish version: $fish_version - OK"
+    fi
+fi
+
+
 if [ "$(uname)" = Darwin ]; then
     if gnohup --version >/dev/null 2>&1; then
         echo " * Nohup installed: OK"
@@ -116,6 +132,7 @@ cp -f conf/config.toml ~/.config/resh.toml
 
 cp -f scripts/shellrc.sh ~/.resh/shellrc
 cp -f scripts/reshctl.sh scripts/widgets.sh scripts/hooks.sh scripts/util.sh ~/.resh/
+cp -f scripts/resh.fish ~/.resh/resh.fish
 
 echo "Generating completions ..."
 bin/resh-control completion bash > ~/.resh/bash_completion.d/_reshctl
@@ -145,6 +162,11 @@ if [ -f ~/.zshrc ]; then
     grep -q '[ -f ~/.resh/shellrc ] && source ~/.resh/shellrc' ~/.zshrc ||\
         echo -e '\n[ -f ~/.resh/shellrc ] && source ~/.resh/shellrc' >> ~/.zshrc
 fi
+# Adding resh to fish config ...
+if fish --version >/dev/null 2>&1; then
+    mkdir -p ~/.config/fish/conf.d
+    echo 'test -f ~/.resh/resh.fish; and source ~/.resh/resh.fish' > ~/.config/fish/conf.d/resh.fish
+fi
 
 # Deleting zsh completion cache - for future use
 # [ ! -e ~/.zcompdump ] || rm ~/.zcompdump
@@ -157,6 +179,13 @@ touch ~/.resh_history.json
 	|| cat /proc/sys/kernel/random/uuid > ~/.resh/resh-uuid 2>/dev/null \
 	|| scripts/uuid.sh > ~/.resh/resh-uuid 2>/dev/null 
 
+# Generating secret key for sanitization (resh-sanitize generates it if this fails) ...
+# the length is checked because exit status of the pipeline doesn't tell whether head and od succeeded
+[ -e ~/.resh/sanitizer-key ] \
+	|| (umask 077 && key=$(head -c 32 /dev/urandom | od -An -tx1 | tr -d ' \n') && [ "${#key}" -eq 64 ] \
+		&& echo "$key" > ~/.resh/sanitizer-key) 2>/dev/null \
+	|| rm -f ~/.resh/sanitizer-key
+
 # Source utils to get __resh_run_daemon function
 # shellcheck source=util.sh
 . ~/.resh/util.sh
@@ -190,7 +219,7 @@ echo "
     Your default shell history will stay intact.
 
  SANITIZATION
-    In sanitized history, all sensitive information is replaced with its SHA1 hashes
+    In sanitized history, all sensitive information is replaced with its keyed hashes (HMAC-SHA256)
      $ reshctl sanitize
 
     If you would consider supporting my research/thesis by giving me a sanitized version of your history then
@@ -201,7 +230,7 @@ echo "
     These bindings do regular stepping through history and prefix search.
     They allow resh to record bindings usage metadata.
     
-     * Enabled by default in zsh
+     * Enabled by default in zsh and fish
      * Disabled by default in bash
 
     Enable/disable for THIS shell session
@@ -217,6 +246,7 @@ echo "
 
  COMPLETIONS
     Zsh and bash completions for 'reshctl' command were installed and should be working.
+    Completions are not available in fish yet.
 
  GRAPHS
     You can get some graphs of your history by running 
@@ -253,5 +283,5 @@ echo "
 
  UNINSTALL
     You can uninstall resh at any time by running 
-     $ rm -rf ~/.resh/
+     $ rm -rf ~/.resh/ ~/.config/fish/conf.d/resh.fish
 "
\ No newline at end of file
@@ -0,0 +1,549 @@
+# resh.fish - resh integration for fish (fish 3.1+)
+# sourced from ~/.config/fish/conf.d/resh.fish
+
+status is-interactive; or exit
+
+contains ~/.resh/bin $PATH; or set -gx PATH $PATH ~/.resh/bin
+
+function __resh_get_uuid
+    cat /proc/sys/kernel/random/uuid 2>/dev/null; or resh-uuid
+end
+
+function __resh_get_epochrealtime
+    if date +%s.%N | string match -qv '*N*'
+        # GNU date
+        date +%s.%N
+    else if gdate --version >/dev/null 2>&1; and gdate +%s.%N | string match -qv '*N*'
+        # GNU date take 2
+        gdate +%s.%N
+    else
+        # dumb date
+        # XXX: we lost precison beyond seconds
+        date +%s
+        if not set -q __RESH_DATE_WARN
+            echo "resh WARN: can't get precise time - consider installing GNU date!" >&2
+            set -g __RESH_DATE_WARN 1
+        end
+    end
+end
+
+function __resh_run_daemon
+    if test (uname) = Darwin
+        # hotfix
+        gnohup resh-daemon >~/.resh/daemon_last_run_out.txt 2>&1 &
+    else
+        setsid resh-daemon >~/.resh/daemon_last_run_out.txt 2>&1 &
+    end
+    disown 2>/dev/null
+end
+
+function __resh_os_release --argument-names key
+    sh -c '. /etc/os-release; eval echo "\$$1"' sh $key
+end
+
+set -g __RESH_MACOS 0
+set -g __RESH_LINUX 0
+set -g __RESH_UNAME (uname)
+
+if test "$__RESH_UNAME" = Darwin
+    set -g __RESH_MACOS 1
+else if test "$__RESH_UNAME" = Linux
+    set -g __RESH_LINUX 1
+else
+    echo "resh PANIC unrecognized OS"
+end
+
+set -g __RESH_SHELL fish
+set -g __RESH_HOST $hostname
+set -g __RESH_HOSTTYPE (uname -m)
+
+# posix
+set -g __RESH_HOME $HOME
+set -g __RESH_LOGIN $LOGNAME
+set -g __RESH_SHELL_ENV $SHELL
+set -g __RESH_TERM $TERM
+
+# non-posix
+set -g __RESH_RT_SESSION (__resh_get_epochrealtime)
+# fish has no $OSTYPE and $MACHTYPE
+set -g __RESH_OSTYPE ""
+set -g __RESH_MACHTYPE ""
+
+if test $__RESH_LINUX -eq 1
+    set -g __RESH_OS_RELEASE_ID (__resh_os_release ID)
+    set -g __RESH_OS_RELEASE_VERSION_ID (__resh_os_release VERSION_ID)
+    set -g __RESH_OS_RELEASE_ID_LIKE (__resh_os_release ID_LIKE)
+    set -g __RESH_OS_RELEASE_NAME (__resh_os_release NAME)
+    set -g __RESH_OS_RELEASE_PRETTY_NAME (__resh_os_release PRETTY_NAME)
+    set -g __RESH_RT_SESS_SINCE_BOOT (cut -d' ' -f1 /proc/uptime)
+else if test $__RESH_MACOS -eq 1
+    set -g __RESH_OS_RELEASE_ID macos
+    set -g __RESH_OS_RELEASE_VERSION_ID (sw_vers -productVersion 2>/dev/null)
+    set -g __RESH_OS_RELEASE_NAME macOS
+    set -g __RESH_OS_RELEASE_PRETTY_NAME "Mac OS X"
+    set -g __RESH_RT_SESS_SINCE_BOOT (sysctl -n kern.boottime | awk '{print $4}' | sed 's/,//g')
+end
+
+set -gx __RESH_VERSION (resh-collect -version)
+set -gx __RESH_REVISION (resh-collect -revision)
+
+function __resh_reset_variables
+    set -g __RESH_HISTNO 0
+    set -g __RESH_HISTNO_MAX ""
+    set -g __RESH_HISTNO_ZERO_LINE ""
+    set -g __RESH_HIST_PREV_LINE ""
+    set -g __RESH_HIST_PREV_PREFIX ""
+    set -g __RESH_HIST_RECALL_ACTIONS ""
+    set -g __RESH_HIST_NO_PREFIX_MODE 0
+    set -g __RESH_HIST_RECALL_STRATEGY ""
+end
+
+# check that this session runs the same resh version as the installed binaries
+function __resh_check_version --argument-names binary
+    if test "$__RESH_VERSION" != ($binary -version)
+        source ~/.resh/resh.fish
+        if test "$__RESH_VERSION" != ($binary -version)
+            echo "RESH WARNING: You probably just updated RESH - PLEASE RESTART OR RELOAD THIS TERMINAL SESSION (resh version: "($binary -version)"; resh version of this terminal session: $__RESH_VERSION)"
+        else
+            echo "RESH INFO: New RESH shell script was loaded - if you encounter any issues please restart this terminal session."
+        end
+    else if test "$__RESH_REVISION" != ($binary -revision)
+        source ~/.resh/resh.fish
+        if test "$__RESH_REVISION" != ($binary -revision)
+            echo "RESH WARNING: You probably just updated RESH - PLEASE RESTART OR RELOAD THIS TERMINAL SESSION (resh revision: "($binary -revision)"; resh revision of this terminal session: $__RESH_REVISION)"
+        end
+    end
+    test "$__RESH_VERSION" = ($binary -version); and test "$__RESH_REVISION" = ($binary -revision)
+end
+
+function __resh_session_init
+    __resh_check_version resh-session-init; or return 1
+    resh-session-init -requireVersion "$__RESH_VERSION" \
+        -requireRevision "$__RESH_REVISION" \
+        -shell "$__RESH_SHELL" \
+        -uname "$__RESH_UNAME" \
+        -sessionId "$__RESH_SESSION_ID" \
+        -parentSessionId "$__RESH_PARENT_SESSION_ID" \
+        -cols "$COLUMNS" \
+        -home "$__RESH_HOME" \
+        -lang "$LANG" \
+        -lcAll "$LC_ALL" \
+        -lines "$LINES" \
+        -login "$__RESH_LOGIN" \
+        -shellEnv "$__RESH_SHELL_ENV" \
+        -term "$__RESH_TERM" \
+        -pid "$fish_pid" \
+        -sessionPid "$__RESH_SESSION_PID" \
+        -host "$__RESH_HOST" \
+        -hosttype "$__RESH_HOSTTYPE" \
+        -ostype "$__RESH_OSTYPE" \
+        -machtype "$__RESH_MACHTYPE" \
+        -shlvl "$SHLVL" \
+        -realtimeBefore (__resh_get_epochrealtime) \
+        -realtimeSession "$__RESH_RT_SESSION" \
+        -realtimeSessSinceBoot "$__RESH_RT_SESS_SINCE_BOOT" \
+        -timezoneBefore (date +%z) \
+        -osReleaseId "$__RESH_OS_RELEASE_ID" \
+        -osReleaseVersionId "$__RESH_OS_RELEASE_VERSION_ID" \
+        -osReleaseIdLike "$__RESH_OS_RELEASE_ID_LIKE" \
+        -osReleaseName "$__RESH_OS_RELEASE_NAME" \
+        -osReleasePrettyName "$__RESH_OS_RELEASE_PRETTY_NAME" \
+        >~/.resh/session_init_last_run_out.txt 2>&1
+    or echo "resh-session-init ERROR: "(head -n 1 ~/.resh/session_init_last_run_out.txt)
+end
+
+# used for collect and collect --recall
+function __resh_collect
+    set -g __RESH_RT_BEFORE (__resh_get_epochrealtime)
+    __resh_check_version resh-collect; or return 1
+    resh-collect -requireVersion "$__RESH_VERSION" \
+        -requireRevision "$__RESH_REVISION" \
+        -shell "$__RESH_SHELL" \
+        -uname "$__RESH_UNAME" \
+        -sessionId "$__RESH_SESSION_ID" \
+        -cols "$COLUMNS" \
+        -home "$__RESH_HOME" \
+        -lang "$LANG" \
+        -lcAll "$LC_ALL" \
+        -lines "$LINES" \
+        -login "$__RESH_LOGIN" \
+        -pwd "$PWD" \
+        -shellEnv "$__RESH_SHELL_ENV" \
+        -term "$__RESH_TERM" \
+        -pid "$fish_pid" \
+        -sessionPid "$__RESH_SESSION_PID" \
+        -host "$__RESH_HOST" \
+        -hosttype "$__RESH_HOSTTYPE" \
+        -ostype "$__RESH_OSTYPE" \
+        -machtype "$__RESH_MACHTYPE" \
+        -shlvl "$SHLVL" \
+        -realtimeBefore "$__RESH_RT_BEFORE" \
+        -realtimeSession "$__RESH_RT_SESSION" \
+        -realtimeSessSinceBoot "$__RESH_RT_SESS_SINCE_BOOT" \
+        -timezoneBefore (date +%z) \
+        -osReleaseId "$__RESH_OS_RELEASE_ID" \
+        -osReleaseVersionId "$__RESH_OS_RELEASE_VERSION_ID" \
+        -osReleaseIdLike "$__RESH_OS_RELEASE_ID_LIKE" \
+        -osReleaseName "$__RESH_OS_RELEASE_NAME" \
+        -osReleasePrettyName "$__RESH_OS_RELEASE_PRETTY_NAME" \
+        -histno "$__RESH_HISTNO" \
+        $argv
+end
+
+function __resh_preexec --on-event fish_preexec
+    set -g __RESH_COLLECT 1
+    # global to preserve it for postcollect (useful as sanity check)
+    set -g __RESH_CMDLINE $argv[1]
+    __resh_collect --cmdLine "$__RESH_CMDLINE" \
+        --recall-actions "$__RESH_HIST_RECALL_ACTIONS" \
+        --recall-strategy "$__RESH_HIST_RECALL_STRATEGY" \
+        --recall-last-cmdline "$__RESH_HIST_PREV_LINE" \
+        >~/.resh/collect_last_run_out.txt 2>&1
+    or echo "resh-collect ERROR: "(head -n 1 ~/.resh/collect_last_run_out.txt)
+end
+
+function __resh_postexec --on-event fish_postexec
+    # has to be the first command to keep both $status and $pipestatus
+    set -l __RESH_EXIT_CODE $status
+    set -l __RESH_PIPESTATUS $pipestatus
+    set -l __RESH_RT_AFTER (__resh_get_epochrealtime)
+    set -q __RESH_COLLECT; or return
+    set -e __RESH_COLLECT
+    if __resh_check_version resh-postcollect
+        resh-postcollect -requireVersion "$__RESH_VERSION" \
+            -requireRevision "$__RESH_REVISION" \
+            -cmdLine "$__RESH_CMDLINE" \
+            -realtimeBefore "$__RESH_RT_BEFORE" \
+            -exitCode "$__RESH_EXIT_CODE" \
+            -pipeStatus "$__RESH_PIPESTATUS" \
+            -sessionId "$__RESH_SESSION_ID" \
+            -shell "$__RESH_SHELL" \
+            -shlvl "$SHLVL" \
+            -pwdAfter "$PWD" \
+            -realtimeAfter "$__RESH_RT_AFTER" \
+            -timezoneAfter (date +%z) \
+            >~/.resh/postcollect_last_run_out.txt 2>&1
+        or echo "resh-postcollect ERROR: "(head -n 1 ~/.resh/postcollect_last_run_out.txt)
+    end
+    __resh_reset_variables
+end
+
+function __resh_helper_arrow_pre
+    # set recall strategy
+    set -g __RESH_HIST_RECALL_STRATEGY "fish_recent - history-search-{backward,forward}"
+    set -l buffer (commandline | string collect)
+    set -l cursor (commandline -C)
+    # set prefix
+    set -g __RESH_PREFIX (string sub -l $cursor -- $buffer | string collect)
+    # cursor not at the end of the line => end "NO_PREFIX_MODE"
+    test $cursor -ne (string length -- $buffer); and set -g __RESH_HIST_NO_PREFIX_MODE 0
+    # if user moved the cursor or made edits (to prefix) from last recall action
+    # => restart histno AND deactivate "NO_PREFIX_MODE" AND clear end of recall list histno
+    if test "$__RESH_PREFIX" != "$__RESH_HIST_PREV_PREFIX"
+        set -g __RESH_HISTNO 0
+        set -g __RESH_HIST_NO_PREFIX_MODE 0
+        set -g __RESH_HISTNO_MAX ""
+    end
+    # "NO_PREFIX_MODE" => set prefix to empty string
+    test $__RESH_HIST_NO_PREFIX_MODE -eq 1; and set -g __RESH_PREFIX ""
+    # histno == 0 => save current line
+    test $__RESH_HISTNO -eq 0; and set -g __RESH_HISTNO_ZERO_LINE $buffer
+end
+
+function __resh_helper_arrow_post
+    set -l buffer (commandline | string collect)
+    # cursor at the beginning of the line => activate "NO_PREFIX_MODE"
+    test (commandline -C) -eq 0; and set -g __RESH_HIST_NO_PREFIX_MODE 1
+    # "NO_PREFIX_MODE" => move cursor to the end of the line
+    test $__RESH_HIST_NO_PREFIX_MODE -eq 1; and commandline -C (string length -- $buffer)
+    # save current prefix so we can spot when user moves cursor or edits (the prefix part of) the line
+    set -g __RESH_HIST_PREV_PREFIX (string sub -l (commandline -C) -- $buffer | string collect)
+    # recorded to history
+    set -g __RESH_HIST_PREV_LINE $buffer
+end
+
+# replace the buffer and keep the cursor where it was (or at the end of the buffer)
+function __resh_helper_set_buffer
+    set -l cursor (commandline -C)
+    commandline -r -- $argv[1]
+    commandline -C $cursor
+end
+
+function __resh_widget_arrow_up
+    # run helper function
+    __resh_helper_arrow_pre
+    # append curent recall action
+    set -g __RESH_HIST_RECALL_ACTIONS "$__RESH_HIST_RECALL_ACTIONS|||arrow_up:$__RESH_PREFIX"
+    # increment histno
+    set -g __RESH_HISTNO (math $__RESH_HISTNO + 1)
+    if test -n "$__RESH_HISTNO_MAX"; and test $__RESH_HISTNO -gt $__RESH_HISTNO_MAX
+        # end of the recall list -> don't recall, do nothing
+        # fix histno
+        set -g __RESH_HISTNO (math $__RESH_HISTNO - 1)
+    else
+        # run recall
+        set -l new_buffer (__resh_collect --recall --prefix-search "$__RESH_PREFIX" 2>~/.resh/arrow_up_last_run_out.txt)
+        set -l status_code $status
+        set new_buffer (string join \n -- $new_buffer)
+        if test $status_code -eq 0
+            __resh_helper_set_buffer $new_buffer
+        else if test $status_code -eq 5
+            # command shared from another session
+            __resh_helper_set_buffer $new_buffer
+            echo "RESH: shared from another session" >&2
+        else
+            # revert histno change on error
+            set -g __RESH_HISTNO (math $__RESH_HISTNO - 1)
+            set -g __RESH_HISTNO_MAX $__RESH_HISTNO
+        end
+    end
+    # run post helper
+    __resh_helper_arrow_post
+    commandline -f repaint
+end
+
+function __resh_widget_arrow_down
+    # run helper function
+    __resh_helper_arrow_pre
+    # append curent recall action
+    set -g __RESH_HIST_RECALL_ACTIONS "$__RESH_HIST_RECALL_ACTIONS|||arrow_down:$__RESH_PREFIX"
+    # decrement histno
+    set -g __RESH_HISTNO (math $__RESH_HISTNO - 1)
+    # prevent HISTNO from getting negative (for now)
+    test $__RESH_HISTNO -lt 0; and set -g __RESH_HISTNO 0
+    if test $__RESH_HISTNO -eq 0
+        # back at histno == 0 => restore original line
+        __resh_helper_set_buffer $__RESH_HISTNO_ZERO_LINE
+    else
+        # run recall
+        set -l new_buffer (__resh_collect --recall --prefix-search "$__RESH_PREFIX" 2>~/.resh/arrow_down_last_run_out.txt)
+        set new_buffer (string join \n -- $new_buffer)
+        # IF new buffer in non-empty THEN use the new buffer ELSE revert histno change
+        if test -n "$new_buffer"
+            __resh_helper_set_buffer $new_buffer
+        else
+            set -g __RESH_HISTNO (math $__RESH_HISTNO + 1)
+        end
+    end
+    __resh_helper_arrow_post
+    commandline -f repaint
+end
+
+function __resh_widget_control_R
+    set -l prevbuffer (commandline | string collect)
+    set -g __RESH_HIST_RECALL_ACTIONS "$__RESH_HIST_RECALL_ACTIONS;control_R:$prevbuffer"
+
+    # command substitution splits output into lines - join them back for multiline commands
+    set -l buffer (resh-cli --sessionID "$__RESH_SESSION_ID" --pwd "$PWD" --shell "$__RESH_SHELL" --query "$prevbuffer")
+    set -l status_code $status
+    switch $status_code
+        case 111 113
+            # execute (113: command is prefixed with cd to its directory)
+            commandline -r -- (string join \n -- $buffer)
+            commandline -f repaint execute
+            return
+        case 0 114
+            # paste (114: command is prefixed with cd to its directory)
+            commandline -r -- (string join \n -- $buffer)
+        case 112
+            # print list of marked commands
+            echo
+            printf '%s\n' $buffer
+            commandline -r -- $prevbuffer
+        case 130
+            commandline -r -- $prevbuffer
+        case '*'
+            printf '%s\n' $buffer >~/.resh/cli_last_run_out.txt
+            echo
+            echo "# RESH cli failed - sorry for the inconvinience (error output was saved to ~/.resh/cli_last_run_out.txt)"
+            commandline -r -- $prevbuffer
+    end
+    commandline -f end-of-line repaint
+end
+
+# vi mode binds to insert mode as well as to default (normal) mode
+function __resh_bind_modes
+    if test "$fish_key_bindings" = fish_vi_key_bindings
+        echo default insert
+    else
+        echo default
+    end
+end
+
+function __resh_bind_arrows
+    if test "$__RESH_arrow_keys_bind_enabled" = 1
+        echo "RESH arrow key bindings are already enabled!"
+        return 1
+    end
+    for mode in (__resh_bind_modes)
+        bind -M $mode \eOA __resh_widget_arrow_up
+        bind -M $mode \e\[A __resh_widget_arrow_up
+        bind -M $mode \eOB __resh_widget_arrow_down
+        bind -M $mode \e\[B __resh_widget_arrow_down
+    end
+    if test "$fish_key_bindings" = fish_vi_key_bindings
+        bind -M default k __resh_widget_arrow_up
+        bind -M default j __resh_widget_arrow_down
+    end
+    set -g __RESH_arrow_keys_bind_enabled 1
+    return 0
+end
+
+function __resh_bind_control_R
+    if test "$__RESH_control_R_bind_enabled" = 1
+        echo "Error: Can't enable control R binding because it is already enabled!"
+        return 1
+    end
+    for mode in (__resh_bind_modes)
+        bind -M $mode \cr __resh_widget_control_R
+    end
+    set -g __RESH_control_R_bind_enabled 1
+    return 0
+end
+
+# erasing user bindings reverts keys to fish preset bindings
+function __resh_unbind_arrows
+    if test "$__RESH_arrow_keys_bind_enabled" != 1
+        echo "Error: Can't disable arrow key bindings because they are not enabled!"
+        return 1
+    end
+    for mode in (__resh_bind_modes)
+        bind -e -M $mode \eOA \e\[A \eOB \e\[B
+    end
+    if test "$fish_key_bindings" = fish_vi_key_bindings
+        bind -e -M default k j
+    end
+    echo "RESH arrow key bindings successfully disabled"
+    set -g __RESH_arrow_keys_bind_enabled 0
+    return 0
+end
+
+function __resh_unbind_control_R
+    if test "$__RESH_control_R_bind_enabled" != 1
+        echo "Error: Can't disable control R binding because it is not enabled!"
+        return 1
+    end
+    for mode in (__resh_bind_modes)
+        bind -e -M $mode \cr
+    end
+    set -g __RESH_control_R_bind_enabled 0
+    return 0
+end
+
+# wrapper for resh-cli for calling resh directly
+function resh
+    set -l buffer (resh-cli --sessionID "$__RESH_SESSION_ID" --pwd "$PWD" --shell "$__RESH_SHELL")
+    set -l status_code $status
+    set buffer (string join \n -- $buffer)
+    switch $status_code
+        case 111 113
+            # execute (113: command is prefixed with cd to its directory)
+            echo $buffer
+            eval $buffer
+        case 0 114
+            # paste (114: command is prefixed with cd to its directory)
+            echo $buffer
+        case 112
+            # print list of marked commands
+            printf '%s\n' $buffer
+        case 130
+            true
+        case '*'
+            echo $buffer >~/.resh/cli_last_run_out.txt
+            echo "resh-cli ERROR:"
+            cat ~/.resh/cli_last_run_out.txt
+    end
+end
+
+function reshctl
+    # export current shell because resh-control needs to know
+    set -gx __RESH_ctl_shell $__RESH_SHELL
+    # run resh-control aka the real reshctl
+    resh-control $argv
+
+    # modify current shell session based on exit status
+    set -l _status $status
+    set -e __RESH_ctl_shell
+    switch $_status
+        case 0 1
+            # success | fail
+            return $_status
+        case 101
+            # enable arrow keys
+            __resh_bind_arrows
+            return 0
+        case 102
+            # enable control R
+            __resh_bind_control_R
+            return 0
+        case 111
+            # disable arrow keys
+            __resh_unbind_arrows
+            return 0
+        case 112
+            # disable control R
+            __resh_unbind_control_R
+            return 0
+        case 200
+            # reload rc files
+            source ~/.resh/resh.fish
+            return 0
+        case 201
+            # inspect session history
+            # reshctl debug inspect N
+            set -l count 10
+            set -q argv[3]; and set count $argv[3]
+            resh-inspect --sessionID "$__RESH_SESSION_ID" --count "$count"
+            return 0
+        case 202
+            # show status
+            if test "$__RESH_arrow_keys_bind_enabled" = 1
+                echo ' * this session: ENABLED'
+            else
+                echo ' * this session: DISABLED'
+            end
+            echo
+            echo 'Control R binding ...'
+            if test (resh-config --key BindControlR) = true
+                echo ' * future sessions: ENABLED (experimental)'
+            else
+                echo ' * future sessions: DISABLED (recommended)'
+            end
+            if test "$__RESH_control_R_bind_enabled" = 1
+                echo ' * this session: ENABLED'
+            else
+                echo ' * this session: DISABLED'
+            end
+            return 0
+        case '*'
+            echo "reshctl() FATAL ERROR: unknown status ($_status)" >&2
+            echo "Possibly caused by version mismatch between installed resh and resh in this session." >&2
+            echo "Please REPORT this issue here: https://github.com/curusarn/resh/issues" >&2
+            echo "Please RESTART your terminal window." >&2
+            return $_status
+    end
+end
+
+__resh_run_daemon
+
+# block for anything we only want to do once per session
+# NOTE: nested shells and shells started from tmux are new sessions - inherited session becomes their parent
+#       sessions are keyed by $fish_pid and $SHLVL so re-sourcing stays in the same session
+if not set -q __RESH_SESSION_ID; or test "$__RESH_SESSION_PID" != "$fish_pid"; or test "$__RESH_SESSION_SHLVL" != "$SHLVL"
+    set -g __RESH_PARENT_SESSION_ID "$__RESH_SESSION_ID"
+    set -gx __RESH_SESSION_ID (__resh_get_uuid)
+    set -gx __RESH_SESSION_PID $fish_pid
+    set -gx __RESH_SESSION_SHLVL "$SHLVL"
+    __resh_reset_variables
+    __resh_session_init
+end
+
+# block for anything we only want to do once per shell
+if not set -q __RESH_INIT_DONE
+    __resh_reset_variables
+
+    test (resh-config --key BindArrowKeysFish) = true; and __resh_bind_arrows >/dev/null
+    test (resh-config --key BindControlR) = true; and __resh_bind_control_R >/dev/null
+
+    set -g __RESH_INIT_DONE 1
+end
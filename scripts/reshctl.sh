@@ -108,15 +108,18 @@ __resh_unbind_all() {
 # wrapper for resh-cli for calling resh directly
 resh() {
     local buffer
-    buffer=$(resh-cli --sessionID "$__RESH_SESSION_ID" --pwd "$PWD")
+    buffer=$(resh-cli --sessionID "$__RESH_SESSION_ID" --pwd "$PWD" --shell "$__RESH_SHELL")
     status_code=$?
-    if [ $status_code = 111 ]; then
-        # execute
+    if [ $status_code = 111 ] || [ $status_code = 113 ]; then
+        # execute (113: command is prefixed with cd to its directory)
         echo "$buffer" 
         eval "$buffer"
-    elif [ $status_code = 0 ]; then
-        # paste
+    elif [ $status_code = 0 ] || [ $status_code = 114 ]; then
+        # paste (114: command is prefixed with cd to its directory)
         echo "$buffer" 
+    elif [ $status_code = 112 ]; then
+        # print list of marked commands
+        printf '%s\n' "$buffer"
     elif [ $status_code = 130 ]; then
         true
     else
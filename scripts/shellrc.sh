@@ -72,10 +72,13 @@ export __RESH_REVISION=$(resh-collect -revision)
 __resh_run_daemon
 
 # block for anything we only want to do once per session
-# NOTE: nested shells are still the same session
-if [ -z "${__RESH_SESSION_ID+x}" ]; then
+# NOTE: nested shells and shells started from tmux are new sessions - inherited session becomes their parent
+#       sessions are keyed by $$ and $SHLVL so subshells and re-sourcing stay in the same session
+if [ -z "${__RESH_SESSION_ID+x}" ] || [ "${__RESH_SESSION_PID-}" != "$$" ] || [ "${__RESH_SESSION_SHLVL-}" != "${SHLVL-}" ]; then
+    __RESH_PARENT_SESSION_ID="${__RESH_SESSION_ID-}"
     export __RESH_SESSION_ID; __RESH_SESSION_ID=$(__resh_get_uuid)
     export __RESH_SESSION_PID="$$"
+    export __RESH_SESSION_SHLVL="${SHLVL-}"
     # TODO add sesson time
     __resh_reset_variables
     __resh_session_init
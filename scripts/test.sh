@@ -19,6 +19,41 @@ for sh in bash zsh; do
     ! $sh -c ". scripts/shellrc.sh; __resh_preexec; __resh_precmd" && echo "Error while running functions!" && exit 1
 done
 
+# prompt is simulated using eval "$PROMPT_COMMAND" - resh-postcollect prints the recorded pipe status
+# shellcheck disable=SC2016
+test_pipestatus='
+    . scripts/hooks.sh
+    __RESH_SHELL=bash __RESH_VERSION=test __RESH_REVISION=test
+    __resh_get_epochrealtime() { echo 0; }
+    resh-postcollect() {
+        case "$1" in
+            -version|-revision) echo test ;;
+            *) while [ $# -gt 0 ]; do [ "$1" = -pipeStatus ] && echo "$2"; shift; done ;;
+        esac
+    }
+    __test_old_bp_precmd_invoke_cmd() {
+        # older bash-preexec overwrites $PIPESTATUS before running precmd functions
+        local ret=$?
+        (exit "$ret")
+        __resh_precmd
+    }
+    __test_bp_precmd_invoke_cmd() {
+        BP_PIPESTATUS=("${PIPESTATUS[@]}")
+        __resh_precmd
+    }
+    PROMPT_COMMAND=$1
+    __RESH_COLLECT=1; true; eval "$PROMPT_COMMAND"
+    __RESH_COLLECT=1; (exit 3) | true | (exit 2); eval "$PROMPT_COMMAND"
+    cat ~/.resh/postcollect_last_run_out.txt
+'
+for hook in __test_old_bp_precmd_invoke_cmd __test_bp_precmd_invoke_cmd; do
+    echo "Checking pipe status recorded by bash hooks ($hook) ..."
+    home=$(mktemp -d) && mkdir "$home/.resh" || exit 1
+    pipestatus=$(HOME="$home" bash -c "$test_pipestatus" bash "$hook")
+    rm -rf "$home"
+    [ "$pipestatus" != "3 0 2" ] && echo "Unexpected pipe status: '$pipestatus' (expected '3 0 2')" && exit 1
+done
+
 # TODO: test installation
 
 exit 0
@@ -137,6 +137,7 @@ __resh_session_init() {
                     -shell "$__RESH_SHELL" \
                     -uname "$__RESH_UNAME" \
                     -sessionId "$__RESH_SESSION_ID" \
+                    -parentSessionId "${__RESH_PARENT_SESSION_ID-}" \
                     -cols "$__RESH_COLS" \
                     -home "$__RESH_HOME" \
                     -lang "$__RESH_LANG" \
@@ -22,6 +22,12 @@ __resh_helper_arrow_pre() {
     # histno == 0 => save current line
     [ "$__RESH_HISTNO" -eq 0 ] && __RESH_HISTNO_ZERO_LINE=$BUFFER
 }
+__resh_helper_mark_shared() {
+    # let the user know that recalled command comes from another session
+    if [ -n "${ZSH_VERSION-}" ]; then
+        zle -M "RESH: shared from another session" 2>/dev/null
+    fi
+}
 __resh_helper_arrow_post() {
     # cursor at the beginning of the line => activate "NO_PREFIX_MODE"
     [ "$CURSOR" -eq 0 ] && __RESH_HIST_NO_PREFIX_MODE=1
@@ -57,6 +63,10 @@ __resh_widget_arrow_up() {
         # shellcheck disable=SC2015
         if [ "${status_code}" -eq 0 ]; then
             BUFFER=$NEW_BUFFER
+        elif [ "${status_code}" -eq 5 ]; then
+            # command shared from another session
+            BUFFER=$NEW_BUFFER
+            __resh_helper_mark_shared
         else
             __RESH_HISTNO=$((__RESH_HISTNO-1))
             __RESH_HISTNO_MAX=$__RESH_HISTNO
@@ -94,10 +104,10 @@ __resh_widget_control_R() {
     __RESH_HIST_RECALL_ACTIONS="$__RESH_HIST_RECALL_ACTIONS;control_R:$BUFFER"
 
     local status_code
-    BUFFER=$(resh-cli --sessionID "$__RESH_SESSION_ID" --pwd "$PWD" --query "$BUFFER")
+    BUFFER=$(resh-cli --sessionID "$__RESH_SESSION_ID" --pwd "$PWD" --shell "$__RESH_SHELL" --query "$BUFFER")
     status_code=$?
-    if [ $status_code = 111 ]; then
-        # execute
+    if [ $status_code = 111 ] || [ $status_code = 113 ]; then
+        # execute (113: command is prefixed with cd to its directory)
         if [ -n "${ZSH_VERSION-}" ]; then
             # zsh
             zle accept-line
@@ -106,12 +116,21 @@ __resh_widget_control_R() {
             # set chained keyseq to accept-line
             bind '"\u[32~": accept-line'
         fi
-    elif [ $status_code = 0 ]; then
+    elif [ $status_code = 0 ] || [ $status_code = 114 ]; then
+        # paste (114: command is prefixed with cd to its directory)
         if [ -n "${BASH_VERSION-}" ]; then
             # bash
             # set chained keyseq to nothing
             bind -x '"\u[32~": __resh_nop'
         fi
+    elif [ $status_code = 112 ]; then
+        # print list of marked commands
+        if [ -n "${ZSH_VERSION-}" ]; then
+            # zsh
+            zle -I
+        fi
+        printf '%s\n' "$BUFFER"
+        BUFFER="$PREVBUFFER"
     elif [ $status_code = 130 ]; then
         BUFFER="$PREVBUFFER"
     else